@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PlakarKorp/notion-integration/notion"
+)
+
+const verifyUsage = `usage: notion-exporter verify [key=value ...] <snapshot_dir> <page_id>
+
+Compares a page saved in a snapshot, restored locally with plakar restore,
+with a live Notion page and reports what differs. The options are the same
+as the connector's, for example token=ntn_xxx.
+`
+
+// verify runs the round-trip verifier and returns the process exit code:
+// 0 when the trees match, 1 when they differ and 2 on error.
+func verify(args []string) int {
+	config := make(map[string]string)
+	var positional []string
+	for _, arg := range args {
+		if key, value, ok := strings.Cut(arg, "="); ok {
+			config[key] = value
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 2 {
+		fmt.Fprint(os.Stderr, verifyUsage)
+		return 2
+	}
+
+	report, err := notion.Verify(config, positional[0], positional[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		return 2
+	}
+	report.Print(os.Stdout)
+	if len(report.Differences) > 0 {
+		return 1
+	}
+	return 0
+}
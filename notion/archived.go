@@ -0,0 +1,273 @@
+package notion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+// Pages and databases in the trash are left out by the search and their
+// blocks by the block children endpoint, but they can still be fetched by
+// ID. With include_archived, the IDs the backup comes across are checked:
+// rootID, the id selectors of include, the child pages, links, mentions and
+// relations found in what is saved, and the subpages of trashed pages. The
+// ones in the trash are added to the tree with their ancestors, and saved
+// as any other page with "archived" and "in_trash" set.
+
+// archiveQueue holds the IDs to check, processed by the scan loop.
+type archiveQueue struct {
+	mu      sync.Mutex
+	pending []string
+	seen    map[string]bool
+	trashed map[string]bool // IDs added from the trash, only used by the scan loop
+}
+
+func newArchiveQueue() *archiveQueue {
+	return &archiveQueue{seen: make(map[string]bool), trashed: make(map[string]bool)}
+}
+
+// push queues the IDs not seen yet. It is a no-op on a nil queue, when
+// include_archived is off.
+func (q *archiveQueue) push(ids ...string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range ids {
+		if id == "" || q.seen[id] {
+			continue
+		}
+		q.seen[id] = true
+		q.pending = append(q.pending, id)
+	}
+}
+
+func (q *archiveQueue) pop() (string, bool) {
+	if q == nil {
+		return "", false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return "", false
+	}
+	id := q.pending[0]
+	q.pending = q.pending[1:]
+	return id, true
+}
+
+func (q *archiveQueue) empty() bool {
+	if q == nil {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) == 0
+}
+
+// archived reports whether a page or database is in the trash.
+func (pg Page) archived() bool {
+	return pg.Archived || pg.InTrash
+}
+
+// addArchived checks the next queued ID, and adds it to the tree when it
+// is in the trash. It returns false when the queue is empty.
+func (p *NotionImporter) addArchived(results chan<- *importer.ScanResult) bool {
+	id, ok := p.archive.pop()
+	if !ok {
+		return false
+	}
+	if p.tree.known(id) {
+		return true
+	}
+	page, err := p.fetchObject(id)
+	if err != nil {
+		// not shared with the integration, or not a page nor a database
+		debugf("skipping archived candidate %s: %v", id, err)
+		return true
+	}
+	// live pages are found by the search, but not the subpages of a page
+	// in the trash
+	if !page.archived() && !p.archive.trashed[page.parentID()] {
+		return true
+	}
+
+	pages := []Page{page}
+	for {
+		parentID := pages[0].parentID()
+		if parentID == "" {
+			break
+		}
+		if p.tree.known(parentID) {
+			break
+		}
+		if pages[0].Parent["type"] == "block_id" {
+			// blocks are only known once their page is read
+			debugf("parent block %s of archived %s is unknown", parentID, pages[0].ID)
+			pages[0].Parent = map[string]any{"type": "workspace", "workspace": true}
+			break
+		}
+		parent, err := p.fetchObject(parentID)
+		if err != nil {
+			// the page is saved at the top when its parent can't be read
+			debugf("parent %s of archived %s is unreachable: %v", parentID, pages[0].ID, err)
+			pages[0].Parent = map[string]any{"type": "workspace", "workspace": true}
+			break
+		}
+		pages = append([]Page{parent}, pages...)
+	}
+	infof("adding %s %s from the trash", page.Object, page.ID)
+	for _, pg := range pages {
+		p.archive.trashed[pg.ID] = pg.archived() || p.archive.trashed[pg.parentID()]
+	}
+	p.AddPagesToTree(pages, results)
+	return true
+}
+
+// parentID returns the ID of the parent of a page, empty for the
+// workspace.
+func (pg Page) parentID() string {
+	parentType, _ := pg.Parent["type"].(string)
+	id, _ := pg.Parent[parentType].(string)
+	return id
+}
+
+// fetchObject fetches a page, or a database when id isn't a page.
+func (p *NotionImporter) fetchObject(id string) (Page, error) {
+	var page Page
+	raw, err := p.client.fetchFromURL(p.client.url("/pages/%s", id))
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.Status == http.StatusBadRequest) {
+		raw, err = p.client.fetchFromURL(p.client.url("/databases/%s", id))
+	}
+	if err != nil {
+		return page, err
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return page, err
+	}
+	err = json.Unmarshal(data, &page)
+	return page, err
+}
+
+// referencedIDs returns the pages and databases a block refers to: child
+// pages and databases, links to pages, and page or database mentions in
+// its text.
+func referencedIDs(block json.RawMessage) []string {
+	var b map[string]any
+	if err := json.Unmarshal(block, &b); err != nil {
+		return nil
+	}
+	var ids []string
+	switch b["type"] {
+	case "child_page", "child_database":
+		id, _ := b["id"].(string)
+		ids = append(ids, id)
+	case "link_to_page":
+		link, _ := b["link_to_page"].(map[string]any)
+		for _, key := range []string{"page_id", "database_id"} {
+			if id, ok := link[key].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return append(ids, mentionedIDs(b)...)
+}
+
+// mentionedIDs walks a JSON value for page and database mentions.
+func mentionedIDs(v any) []string {
+	var ids []string
+	switch v := v.(type) {
+	case map[string]any:
+		if mention, ok := v["mention"].(map[string]any); ok {
+			for _, key := range []string{"page", "database"} {
+				if ref, ok := mention[key].(map[string]any); ok {
+					id, _ := ref["id"].(string)
+					ids = append(ids, id)
+				}
+			}
+		}
+		for _, value := range v {
+			ids = append(ids, mentionedIDs(value)...)
+		}
+	case []any:
+		for _, value := range v {
+			ids = append(ids, mentionedIDs(value)...)
+		}
+	}
+	return ids
+}
+
+// relatedIDs returns the pages the relation properties of a page point
+// to.
+func relatedIDs(pg Page) []string {
+	var ids []string
+	for _, prop := range pg.Properties {
+		p, _ := prop.(map[string]any)
+		if p["type"] != "relation" {
+			continue
+		}
+		relations, _ := p["relation"].([]any)
+		for _, relation := range relations {
+			r, _ := relation.(map[string]any)
+			if id, ok := r["id"].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// archivedObject is a page or database restored from the trash.
+type archivedObject struct {
+	object string // "pages" or "databases"
+	id     string
+}
+
+// takeArchived removes the trash flags from a page or database payload, as
+// objects can't be created in the trash, and reports whether they were set.
+func takeArchived(payload map[string]any) bool {
+	archived, _ := payload["archived"].(bool)
+	inTrash, _ := payload["in_trash"].(bool)
+	delete(payload, "archived")
+	delete(payload, "in_trash")
+	return archived || inTrash
+}
+
+// restoredArchived records a page or database that was in the trash when
+// it was backed up. It is restored as a live object, unless keep_archived
+// is set and it is moved back to the trash once the restore is done.
+func (n *NotionExporter) restoredArchived(object, id string) {
+	if !n.keepArchived {
+		n.plan.transform(object + " restored from the trash")
+		return
+	}
+	n.archived = append(n.archived, archivedObject{object: object, id: id})
+}
+
+// archiveRestored moves the objects recorded by restoredArchived to the
+// trash, the most nested ones first.
+func (n *NotionExporter) archiveRestored() error {
+	for i := len(n.archived) - 1; i >= 0; i-- {
+		obj := n.archived[i]
+		if n.plan != nil {
+			n.plan.requests++
+			n.plan.transform(obj.object + " moved back to the trash")
+			continue
+		}
+		payload, err := json.Marshal(map[string]any{"archived": true})
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		if _, err := n.client.makeRequest("PATCH", n.client.url("/%s/%s", obj.object, obj.id), payload); err != nil {
+			return fmt.Errorf("failed to archive %s %s: %w", obj.object, obj.id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package notion
+
+import "testing"
+
+func TestScanIncludeArchived(t *testing.T) {
+	src := newMockNotion(t)
+	page := src.AddPage("workspace", "", "Spec")
+	trashed := src.AddPage("page_id", page, "Old draft")
+	src.AddParagraph(trashed, "deleted text")
+	sub := src.AddPage("page_id", trashed, "Notes")
+	src.AddBlock(page, "link_to_page", map[string]any{"type": "page_id", "page_id": trashed})
+	src.Archive(trashed)
+
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+	if _, ok := files["/"+page+"/"+trashed+"/page.json"]; ok {
+		t.Fatalf("page in the trash saved without include_archived")
+	}
+
+	files = scanSnapshot(t, newTestImporter(t, src, map[string]string{"include_archived": "true"}))
+	saved := decodeFile[map[string]any](t, files, "/"+page+"/"+trashed+"/page.json")
+	if saved["archived"] != true {
+		t.Errorf("page from the trash saved without archived: %v", saved["archived"])
+	}
+	decodeFile[map[string]any](t, files, "/"+page+"/"+trashed+"/"+sub+"/page.json")
+	if got := decodeFile[manifest](t, files, "/manifest.json"); got.Counts.Archived != 1 {
+		t.Errorf("manifest counts %d archived pages, expected 1", got.Counts.Archived)
+	}
+
+	for _, keep := range []bool{false, true} {
+		dst := newMockNotion(t)
+		root := dst.AddPage("workspace", "", "Restore")
+		config := map[string]string{}
+		if keep {
+			config["keep_archived"] = "true"
+		}
+		exp, _ := newTestExporter(t, dst, root, config)
+		restoreSnapshot(t, exp, subtree(files, "/"+page+"/"+trashed))
+
+		restored := childTitles(dst, root)["Old draft"]
+		if restored == "" {
+			t.Fatalf("keep_archived=%v: page from the trash not restored", keep)
+		}
+		if got := dst.Object(restored)["archived"] == true; got != keep {
+			t.Errorf("keep_archived=%v: restored page archived = %v", keep, got)
+		}
+		if blocks := blockTexts(dst, restored); !equalStrings(blocks, []string{"paragraph:deleted text", "child_page"}) {
+			t.Errorf("keep_archived=%v: unexpected restored blocks %v", keep, blocks)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package notion
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tokenPrefixes are the prefixes of Notion integration tokens, "secret_"
+// for the ones created before September 2024.
+var tokenPrefixes = []string{"ntn_", "secret_"}
+
+// checkTokenFormat catches tokens that can't be Notion tokens, such as an
+// integration ID or a token pasted with surrounding quotes or spaces.
+func checkTokenFormat(token string) error {
+	if token == "" {
+		return fmt.Errorf("invalid token: the token is empty")
+	}
+	if strings.TrimSpace(token) != token || strings.ContainsAny(token, "\"'") {
+		return fmt.Errorf("invalid token: remove the spaces or quotes around it")
+	}
+	for _, prefix := range tokenPrefixes {
+		if strings.HasPrefix(token, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid token: Notion tokens start with %q or %q, copy the internal integration secret from the integration settings", tokenPrefixes[0], tokenPrefixes[1])
+}
+
+// status sends a request and returns the status code of its response.
+func (c *client) status(method, url string, body []byte) (int, error) {
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+	resp, err := c.do(method, url, contentType, body)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// checkCapability sends a request that the integration can only make with
+// capability, and reports a missing capability or an unreachable object.
+func (c *client) checkCapability(capability, what, method, url string, body []byte) error {
+	status, err := c.status(method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to check the %s capability: %w", capability, err)
+	}
+	switch status {
+	case http.StatusForbidden:
+		return fmt.Errorf("the integration can't %s: enable the %q capability in its settings", what, capability)
+	case http.StatusNotFound:
+		return fmt.Errorf("the integration can't %s: share the page with the integration", what)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("the token was rejected by Notion, check that it is still valid")
+	}
+	return nil
+}
+
+// canListUsers reports whether the integration has the "Read user
+// information" capability, which users.json and the mapping of people by
+// email need. Both are optional, so a missing capability isn't an error.
+func (c *client) canListUsers() (bool, error) {
+	status, err := c.status("GET", c.url("/users?page_size=1"), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the Read user information capability: %w", err)
+	}
+	if status == http.StatusUnauthorized {
+		return false, fmt.Errorf("the token was rejected by Notion, check that it is still valid")
+	}
+	return status != http.StatusForbidden, nil
+}
+
+// checkAccess checks that the integration can read what a backup
+// reads.
+func (p *NotionImporter) checkAccess() error {
+	if err := p.client.checkCapability("Read content", "search the workspace", "POST", p.client.url("/search"), []byte(`{"page_size":1}`)); err != nil {
+		return err
+	}
+	readUsers, err := p.client.canListUsers()
+	if err != nil {
+		return err
+	}
+	if !readUsers {
+		warnf("the integration can't list the users, users.json is left out: enable the %q capability in its settings to save it", "Read user information")
+		p.stats.omit("users.json", "missing Read user information capability")
+	}
+	p.users = readUsers
+	if p.comments != CommentsNone {
+		// any ID will do, the capability is checked before the block
+		status, err := p.client.status("GET", p.client.url("/comments?block_id=%s&page_size=1", p.bot.ID), nil)
+		if err != nil {
+			return fmt.Errorf("failed to check the Read comments capability: %w", err)
+		}
+		if status == http.StatusForbidden {
+			return fmt.Errorf("the integration can't read comments: enable the %q capability in its settings, or set comments=none", "Read comments")
+		}
+	}
+	if p.scope != "" {
+		if err := p.client.checkCapability("Read content", "read rootID "+p.scope, "GET", p.client.url("/blocks/%s", p.scope), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAccess checks that rootID is a page the integration can read and
+// insert content in, before anything is staged.
+func (n *NotionExporter) checkAccess() error {
+	if _, err := fetchBot(n.client); err != nil {
+		return fmt.Errorf("failed to validate token: %w", err)
+	}
+	if err := n.client.checkCapability("Read content", "read rootID "+n.rootID, "GET", n.client.url("/pages/%s", n.rootID), nil); err != nil {
+		return err
+	}
+	// appending no block changes nothing, but is refused without the
+	// capability
+	if err := n.client.checkCapability("Insert content", "insert content in rootID "+n.rootID, "PATCH", n.client.url("/blocks/%s/children", n.rootID), []byte(`{"children":[]}`)); err != nil {
+		return err
+	}
+	if n.mapUsers {
+		readUsers, err := n.client.canListUsers()
+		if err != nil {
+			return err
+		}
+		if !readUsers {
+			warnf("the integration can't list the users, people properties will be dropped: enable the %q capability in its settings to map them by email", "Read user information")
+			n.usersDenied = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package notion
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/kloset/snapshot/exporter"
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+func TestCheckTokenFormat(t *testing.T) {
+	for _, token := range []string{"ntn_abc", "secret_abc"} {
+		if err := checkTokenFormat(token); err != nil {
+			t.Errorf("checkTokenFormat(%q) = %v", token, err)
+		}
+	}
+	for _, token := range []string{"", "abc", " ntn_abc", `"ntn_abc"`} {
+		if err := checkTokenFormat(token); err == nil {
+			t.Errorf("checkTokenFormat(%q) accepted an invalid token", token)
+		}
+	}
+}
+
+func TestConstructorsCheckAccess(t *testing.T) {
+	ctx := context.Background()
+	newImporter := func(m *mockNotion, config map[string]string) error {
+		cfg := map[string]string{"token": mockToken, "base_url": m.baseURL()}
+		for k, v := range config {
+			cfg[k] = v
+		}
+		_, err := NewNotionImporter(ctx, &importer.Options{}, "notion", cfg)
+		return err
+	}
+	newExporter := func(m *mockNotion, rootID string, config map[string]string) error {
+		cfg := map[string]string{"token": mockToken, "base_url": m.baseURL(), "rootID": rootID}
+		for k, v := range config {
+			cfg[k] = v
+		}
+		_, err := NewNotionExporter(ctx, &exporter.Options{}, "notion", cfg)
+		return err
+	}
+
+	m := newMockNotion(t)
+	m.Deny("read_comments")
+	if err := newImporter(m, nil); err == nil || !strings.Contains(err.Error(), "comments=none") {
+		t.Errorf("importer without Read comments: %v", err)
+	}
+	if err := newImporter(m, map[string]string{"comments": "none"}); err != nil {
+		t.Errorf("importer with comments=none: %v", err)
+	}
+	if err := newImporter(m, map[string]string{"comments": "none", "rootID": "00000000-0000-4000-8000-999999999999"}); err == nil || !strings.Contains(err.Error(), "share the page") {
+		t.Errorf("importer with an unknown rootID: %v", err)
+	}
+
+	m = newMockNotion(t)
+	root := m.AddPage("workspace", "", "Restore")
+	if err := newExporter(m, root, nil); err != nil {
+		t.Errorf("exporter: %v", err)
+	}
+	if err := newExporter(m, "00000000-0000-4000-8000-999999999999", nil); err == nil || !strings.Contains(err.Error(), "share the page") {
+		t.Errorf("exporter with an unknown rootID: %v", err)
+	}
+	m.Deny("insert_content")
+	if err := newExporter(m, root, nil); err == nil || !strings.Contains(err.Error(), `"Insert content"`) {
+		t.Errorf("exporter without Insert content: %v", err)
+	}
+}
+
+func TestMissingUsersCapability(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	src.Deny("read_users")
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+	if _, ok := files["/users.json"]; ok {
+		t.Errorf("users.json saved without the Read user information capability")
+	}
+	decodeFile[map[string]any](t, files, "/"+f.page+"/page.json")
+	if got := decodeFile[manifest](t, files, "/manifest.json"); got.Omitted["users.json"] == "" {
+		t.Errorf("manifest omitted = %v", got.Omitted)
+	}
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	dst.Deny("read_users")
+	exp, _ := newTestExporter(t, dst, root, map[string]string{"map_users": "true"})
+	restoreSnapshot(t, exp, files)
+	if childTitles(dst, root)["Spec"] == "" {
+		t.Errorf("snapshot not restored without the Read user information capability")
+	}
+}
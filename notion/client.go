@@ -0,0 +1,353 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRetries = 5 // Number of times a rate-limited request is retried
+
+// client is the HTTP layer shared by the importer and the exporter. It
+// holds what every request to the Notion API needs and retries requests
+// rejected by the rate limiter.
+type client struct {
+	baseURL  string
+	version  string // Notion-Version header, see the api_version option
+	http     *http.Client
+	oauth    *oauth    // set for public integrations, whose token is refreshed
+	progress *progress // counts the requests and the rate-limit waits, if set
+	metrics  *metrics
+	limiter  *limiter // shared by the goroutines fetching in parallel
+	pageSize int      // results per list request, see the page_size option
+
+	mu    sync.Mutex // guards token, replaced when it is refreshed
+	token string
+}
+
+func newClient(baseURL, token string) *client {
+	if baseURL == "" {
+		baseURL = NotionURL
+	}
+	return &client{
+		baseURL:  baseURL,
+		token:    token,
+		version:  NotionVersionHeader,
+		http:     http.DefaultClient,
+		metrics:  newMetrics(),
+		limiter:  &limiter{interval: time.Second / DefaultRateLimit},
+		pageSize: PageSize,
+	}
+}
+
+// newClientFromConfig returns a client for the token, or the OAuth
+// credentials, and the optional base_url, api_version, page_size and
+// rate_limit of a connector configuration.
+func newClientFromConfig(config map[string]string) (*client, error) {
+	c, err := newOfflineClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := config["client_id"]; ok {
+		auth, err := oauthFromConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		c.oauth = auth
+		if err := c.refresh(""); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	token, err := resolveToken(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTokenFormat(token); err != nil {
+		return nil, err
+	}
+	c.token = token
+	return c, nil
+}
+
+// newOfflineClient returns a client with the options of a connector
+// configuration but no credentials, for a dry run: the token is neither
+// read nor refreshed, and the client must not make any request.
+func newOfflineClient(config map[string]string) (*client, error) {
+	c := newClient(config["base_url"], "")
+	if version, ok := config["api_version"]; ok {
+		if _, err := time.Parse("2006-01-02", version); err != nil {
+			return nil, fmt.Errorf("invalid api_version value %q: %w", version, err)
+		}
+		c.version = version
+	}
+	if value, ok := config["page_size"]; ok {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page_size value %q: %w", value, err)
+		}
+		if size < 1 || size > 100 {
+			return nil, fmt.Errorf("invalid page_size value %q: must be between 1 and 100", value)
+		}
+		c.pageSize = size
+	}
+	if value, ok := config["rate_limit"]; ok {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate_limit value %q: %w", value, err)
+		}
+		if rate < 0 {
+			return nil, fmt.Errorf("invalid rate_limit value %q: must not be negative", value)
+		}
+		c.limiter.interval = 0
+		if rate > 0 {
+			c.limiter.interval = time.Duration(float64(time.Second) / rate)
+		}
+	}
+	if err := c.metrics.configure(config); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// accessToken returns the token requests are currently authenticated with.
+func (c *client) accessToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// dataSources reports whether the API version of the client splits
+// databases into data sources, which then hold the schema and the rows.
+func (c *client) dataSources() bool {
+	return c.version >= DataSourcesVersion
+}
+
+// url returns the API URL for an endpoint such as "/pages/<id>".
+func (c *client) url(format string, args ...any) string {
+	return c.baseURL + fmt.Sprintf(format, args...)
+}
+
+// do sends a request to the Notion API with the authentication and
+// version headers set, once the limiter lets it through. A 429 response
+// is retried after the delay given in its Retry-After header. With OAuth credentials, a 401 response is
+// retried once with a refreshed access token.
+func (c *client) do(method, url, contentType string, body []byte) (*http.Response, error) {
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		var rd io.Reader
+		if body != nil {
+			rd = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, url, rd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		token := c.accessToken()
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Notion-Version", c.version)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		c.limiter.wait()
+		resp, err := c.send(req)
+		c.progress.request()
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute request: %w", err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && c.oauth != nil && !refreshed {
+			resp.Body.Close()
+			if err := c.refresh(token); err != nil {
+				return nil, err
+			}
+			c.metrics.retries.WithLabelValues(endpointOf(c.baseURL, url), "unauthorized").Inc()
+			refreshed = true
+			continue
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+		wait := retryAfter(resp)
+		c.progress.rateLimit(wait)
+		c.metrics.retries.WithLabelValues(endpointOf(c.baseURL, url), "rate_limited").Inc()
+		c.limiter.pause(wait)
+	}
+}
+
+// retryAfter returns how long to wait before retrying a rate-limited
+// request, one second when the server doesn't say.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// APIError is an error response of the Notion API. It carries what Notion
+// says about the error and the object it is about, never the request nor
+// the response body.
+type APIError struct {
+	Status   int
+	Code     string // Notion error code, such as "object_not_found"
+	Message  string
+	Endpoint string // API endpoint of the request, without its query
+	ObjectID string // ID of the page, database or block requested, if any
+}
+
+func (e *APIError) Error() string {
+	code := e.Code
+	if code == "" {
+		code = http.StatusText(e.Status)
+	}
+	object := e.Endpoint
+	if e.ObjectID != "" {
+		object = e.ObjectID
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("notion API error on %s: %s (status %d)", object, code, e.Status)
+	}
+	return fmt.Sprintf("notion API error on %s: %s: %s (status %d)", object, code, redact(e.Message), e.Status)
+}
+
+// apiError returns the error of a failed request to url. The response
+// body is only logged at the debug level.
+func (c *client) apiError(url string, resp *http.Response) *APIError {
+	endpoint, query, _ := strings.Cut(strings.TrimPrefix(url, c.baseURL), "?")
+	e := &APIError{Status: resp.StatusCode, Endpoint: endpoint}
+
+	// "/pages/<id>", "/blocks/<id>/children" or "/comments?block_id=<id>"
+	if parts := strings.Split(strings.TrimPrefix(endpoint, "/"), "/"); len(parts) > 1 && parts[0] != "oauth" {
+		e.ObjectID = parts[1]
+	} else if values, err := neturl.ParseQuery(query); err == nil {
+		e.ObjectID = values.Get("block_id")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return e
+	}
+	debugf("error response of %s: %s", endpoint, body)
+	var notionErr struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &notionErr) == nil {
+		e.Code = notionErr.Code
+		e.Message = notionErr.Message
+	}
+	return e
+}
+
+func (c *client) fetchFromURL(url string) (map[string]any, error) {
+	resp, err := c.do("GET", url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(url, resp)
+	}
+
+	var result map[string]any
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	delete(result, "request_id")
+
+	return result, nil
+}
+
+func (c *client) makeRequest(method, url string, payload []byte) (map[string]any, error) {
+	resp, err := c.do(method, url, "application/json", payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.apiError(url, resp)
+	}
+	jsonData := map[string]any{}
+	err = json.NewDecoder(resp.Body).Decode(&jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return jsonData, nil
+}
+
+// fetchList follows the pagination cursors of a list endpoint and returns
+// all its results. url must already have a query string.
+func (c *client) fetchList(url string) ([]json.RawMessage, error) {
+	var results []json.RawMessage
+	cursor := ""
+	for {
+		pageURL := url
+		if cursor != "" {
+			pageURL += fmt.Sprintf("&start_cursor=%s", cursor)
+		}
+
+		rawResponse, err := c.fetchFromURL(pageURL)
+		if err != nil {
+			return nil, err
+		}
+		rawJSON, err := json.Marshal(rawResponse)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal raw response: %w", err)
+		}
+		var resp BlockResponse
+		if err := json.Unmarshal(rawJSON, &resp); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal list response: %w", err)
+		}
+
+		results = append(results, resp.Results...)
+		if !resp.HasMore {
+			return results, nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// queryRows follows the pagination of a database or data source query.
+func (c *client) queryRows(url string) ([]map[string]any, error) {
+	var rows []map[string]any
+	cursor := ""
+	for {
+		body := map[string]any{"page_size": c.pageSize}
+		if cursor != "" {
+			body["start_cursor"] = cursor
+		}
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		resp, err := c.makeRequest("POST", url, payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", url, err)
+		}
+		results, _ := resp["results"].([]any)
+		for _, r := range results {
+			if row, ok := r.(map[string]any); ok {
+				rows = append(rows, row)
+			}
+		}
+		hasMore, _ := resp["has_more"].(bool)
+		cursor, _ = resp["next_cursor"].(string)
+		if !hasMore || cursor == "" {
+			return rows, nil
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// Values of the importer "comments" option.
+const (
+	CommentsAll   = "all"   // comments on pages and on their blocks
+	CommentsPages = "pages" // page-level comments only, the default
+	CommentsNone  = "none"
+)
+
+// fetchComments returns all the comments whose parent is blockID, which may
+// be a page ID for page-level comments.
+func fetchComments(c *client, blockID string) ([]json.RawMessage, error) {
+	comments, err := c.fetchList(c.url("/comments?block_id=%s&page_size=%d", blockID, c.pageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch comments of %s: %w", blockID, err)
+	}
+	return comments, nil
+}
+
+// newCommentsReader returns the comments.json of a page or block container:
+// the comments on the container itself, and depending on the comments
+// option, the comments on each of its direct child blocks, as read for its
+// page.json or blocks.json.
+func (p *NotionImporter) newCommentsReader(id string, withContainer bool) (io.Reader, error) {
+	var comments []json.RawMessage
+	if withContainer {
+		pageComments, err := fetchComments(p.client, id)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, pageComments...)
+	}
+
+	if p.comments == CommentsAll {
+		for _, childID := range p.blockIDs[id] {
+			blockComments, err := fetchComments(p.client, childID)
+			if err != nil {
+				return nil, err
+			}
+			comments = append(comments, blockComments...)
+		}
+	}
+
+	if comments == nil {
+		comments = []json.RawMessage{}
+	}
+	data, err := json.Marshal(comments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal comments: %w", err)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// restoreComments recreates the discussions saved in dir/comments.json.
+// Comments are always created as the integration, so when attribution is
+// enabled the original author and date are prepended to their text.
+// The container is the new page or block the comments.json belongs to, it
+// receives page-level comments and comments on blocks that were not restored.
+func (n *NotionExporter) restoreComments(dir, containerType, containerID string) error {
+	pathname := path.Join(dir, "comments.json")
+	f, err := os.Open(pathname)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open %s: %w", pathname, err)
+	}
+	defer f.Close()
+
+	var comments []map[string]any
+	if err := json.NewDecoder(f).Decode(&comments); err != nil {
+		return fmt.Errorf("failed to decode JSON from %s: %w", pathname, err)
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		ti, _ := comments[i]["created_time"].(string)
+		tj, _ := comments[j]["created_time"].(string)
+		return ti < tj
+	})
+
+	discussions := make(map[string]string) // old discussion ID -> new one
+	for _, comment := range comments {
+		richText, _ := comment["rich_text"].([]any)
+		if n.commentAttribution {
+			richText = append([]any{n.attributionText(comment)}, richText...)
+		}
+		payload := map[string]any{"rich_text": richText}
+
+		oldDiscussion, _ := comment["discussion_id"].(string)
+		if newDiscussion, ok := discussions[oldDiscussion]; ok {
+			payload["discussion_id"] = newDiscussion
+		} else {
+			payload["parent"] = n.commentParent(comment, containerType, containerID)
+		}
+
+		newDiscussion, err := n.createComment(payload)
+		if err != nil {
+			warnf("failed to restore comment %v: %v", comment["id"], err)
+			continue
+		}
+		if oldDiscussion != "" && newDiscussion != "" {
+			discussions[oldDiscussion] = newDiscussion
+		}
+	}
+	return nil
+}
+
+// commentParent returns the parent of the first comment of a discussion in
+// the restored tree.
+func (n *NotionExporter) commentParent(comment map[string]any, containerType, containerID string) map[string]any {
+	parent, _ := comment["parent"].(map[string]any)
+	if parent["type"] == "block_id" {
+		oldID, _ := parent["block_id"].(string)
+		if newID, ok := n.blockIDs[oldID]; ok {
+			return map[string]any{"block_id": newID}
+		}
+	}
+	return map[string]any{containerType: containerID}
+}
+
+func (n *NotionExporter) attributionText(comment map[string]any) map[string]any {
+	author := "unknown user"
+	if createdBy, ok := comment["created_by"].(map[string]any); ok {
+		if id, ok := createdBy["id"].(string); ok {
+			author = n.userName(id)
+		}
+	}
+	created, _ := comment["created_time"].(string)
+
+	content := fmt.Sprintf("%s (%s): ", author, created)
+	return map[string]any{
+		"type":        "text",
+		"text":        map[string]any{"content": content},
+		"annotations": map[string]any{"italic": true},
+	}
+}
+
+// createComment creates a comment and returns its discussion ID.
+func (n *NotionExporter) createComment(payload map[string]any) (string, error) {
+	if n.plan != nil {
+		n.plan.comment()
+		return n.plan.fakeID(), nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	jsonData, err := n.client.makeRequest("POST", n.client.url("/comments"), data)
+	if err != nil {
+		return "", err
+	}
+	discussionID, _ := jsonData["discussion_id"].(string)
+	return discussionID, nil
+}
@@ -0,0 +1,201 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// databaseColumns returns the property names of a database schema, title
+// first and the others in alphabetical order.
+func databaseColumns(schema map[string]any) []string {
+	columns := make([]string, 0, len(schema))
+	title := ""
+	for name, prop := range schema {
+		if p, ok := prop.(map[string]any); ok && p["type"] == "title" {
+			title = name
+			continue
+		}
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	if title != "" {
+		columns = append([]string{title}, columns...)
+	}
+	return columns
+}
+
+// propertyResolver turns the references found in property values into text.
+type propertyResolver struct {
+	user func(id string) string // name of a user
+	page func(id string) string // title of a related page
+}
+
+// propertyText converts a page property value to text.
+func (r *propertyResolver) propertyText(prop map[string]any) string {
+	propType, _ := prop["type"].(string)
+	return r.valueText(propType, prop[propType])
+}
+
+func (r *propertyResolver) valueText(valueType string, value any) string {
+	switch valueType {
+	case "title", "rich_text":
+		rt, _ := value.([]any)
+		return plainText(rt)
+	case "number":
+		if n, ok := value.(float64); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64)
+		}
+	case "checkbox", "boolean":
+		if b, ok := value.(bool); ok {
+			return strconv.FormatBool(b)
+		}
+	case "string", "url", "email", "phone_number", "created_time", "last_edited_time":
+		s, _ := value.(string)
+		return s
+	case "select", "status":
+		option, _ := value.(map[string]any)
+		name, _ := option["name"].(string)
+		return name
+	case "multi_select":
+		options, _ := value.([]any)
+		return joinValues(options, func(v map[string]any) string {
+			name, _ := v["name"].(string)
+			return name
+		})
+	case "date":
+		date, _ := value.(map[string]any)
+		start, _ := date["start"].(string)
+		if end, ok := date["end"].(string); ok && end != "" {
+			return start + "/" + end
+		}
+		return start
+	case "people":
+		people, _ := value.([]any)
+		return joinValues(people, r.userName)
+	case "created_by", "last_edited_by":
+		user, _ := value.(map[string]any)
+		return r.userName(user)
+	case "relation":
+		relations, _ := value.([]any)
+		return joinValues(relations, func(v map[string]any) string {
+			id, _ := v["id"].(string)
+			return r.page(id)
+		})
+	case "files":
+		files, _ := value.([]any)
+		return joinValues(files, func(v map[string]any) string {
+			name, _ := v["name"].(string)
+			return name
+		})
+	case "formula":
+		formula, _ := value.(map[string]any)
+		formulaType, _ := formula["type"].(string)
+		return r.valueText(formulaType, formula[formulaType])
+	case "rollup":
+		rollup, _ := value.(map[string]any)
+		rollupType, _ := rollup["type"].(string)
+		if rollupType == "array" {
+			items, _ := rollup["array"].([]any)
+			return joinValues(items, r.propertyText)
+		}
+		return r.valueText(rollupType, rollup[rollupType])
+	case "unique_id":
+		uid, _ := value.(map[string]any)
+		number := r.valueText("number", uid["number"])
+		if prefix, ok := uid["prefix"].(string); ok && prefix != "" {
+			return prefix + "-" + number
+		}
+		return number
+	case "verification":
+		verification, _ := value.(map[string]any)
+		state, _ := verification["state"].(string)
+		return state
+	}
+	return ""
+}
+
+func (r *propertyResolver) userName(user map[string]any) string {
+	if name, ok := user["name"].(string); ok && name != "" {
+		return name
+	}
+	id, _ := user["id"].(string)
+	return r.user(id)
+}
+
+func joinValues(values []any, text func(map[string]any) string) string {
+	texts := make([]string, 0, len(values))
+	for _, v := range values {
+		if m, ok := v.(map[string]any); ok {
+			texts = append(texts, text(m))
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// writeCSV writes one line per row with a column per property of schema.
+func writeCSV(w io.Writer, schema map[string]any, rows []map[string]any, r *propertyResolver) error {
+	columns := databaseColumns(schema)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, name := range columns {
+			if prop, ok := row[name].(map[string]any); ok {
+				record[i] = r.propertyText(prop)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// newCSVReader builds the rows.csv of a database from its schema and the
+// properties of its saved rows, as returned by the search.
+func (p *NotionImporter) newCSVReader(id string) (io.Reader, error) {
+	database, children, ok := p.tree.children(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown database %s", id)
+	}
+
+	var rows []map[string]any
+	for _, child := range children {
+		rows = append(rows, child.Properties)
+	}
+
+	resolver := &propertyResolver{
+		user: func(id string) string {
+			_, names, err := p.workspaceUsers()
+			if err != nil {
+				return id
+			}
+			if name, ok := names[id]; ok && name != "" {
+				return name
+			}
+			return id
+		},
+		page: func(id string) string {
+			if page, ok := p.tree.page(id); ok {
+				if title := titleOf(map[string]any{"properties": page.Properties}); title != "" {
+					return title
+				}
+			}
+			return id
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, database.Properties, rows, resolver); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return &buf, nil
+}
@@ -0,0 +1,83 @@
+package notion
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteCSVConvertsProperties(t *testing.T) {
+	schema := map[string]any{
+		"Name":     map[string]any{"type": "title"},
+		"Status":   map[string]any{"type": "select"},
+		"Due":      map[string]any{"type": "date"},
+		"Owner":    map[string]any{"type": "people"},
+		"Blocks":   map[string]any{"type": "relation"},
+		"Estimate": map[string]any{"type": "formula"},
+		"Tags":     map[string]any{"type": "multi_select"},
+	}
+	rows := []map[string]any{{
+		"Name":   map[string]any{"type": "title", "title": richText("Ship, then rest")},
+		"Status": map[string]any{"type": "select", "select": map[string]any{"name": "Done"}},
+		"Due":    map[string]any{"type": "date", "date": map[string]any{"start": "2025-01-01", "end": "2025-01-03"}},
+		"Owner": map[string]any{"type": "people", "people": []any{
+			map[string]any{"object": "user", "id": "user-1"},
+			map[string]any{"object": "user", "id": "user-2", "name": "Grace"},
+		}},
+		"Blocks":   map[string]any{"type": "relation", "relation": []any{map[string]any{"id": "page-1"}}},
+		"Estimate": map[string]any{"type": "formula", "formula": map[string]any{"type": "number", "number": 2.5}},
+		"Tags": map[string]any{"type": "multi_select", "multi_select": []any{
+			map[string]any{"name": "a"}, map[string]any{"name": "b"},
+		}},
+	}}
+	resolver := &propertyResolver{
+		user: func(id string) string { return map[string]string{"user-1": "Ada"}[id] },
+		page: func(id string) string { return map[string]string{"page-1": "Design"}[id] },
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, schema, rows, resolver); err != nil {
+		t.Fatalf("writeCSV: %v", err)
+	}
+	want := "Name,Blocks,Due,Estimate,Owner,Status,Tags\n" +
+		"\"Ship, then rest\",Design,2025-01-01/2025-01-03,2.5,\"Ada, Grace\",Done,\"a, b\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestScanSavesDatabaseRows(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+
+	files := scanSnapshot(t, newTestImporter(t, m, map[string]string{"csv": "true"}))
+
+	if got := string(files["/"+f.page+"/"+f.database+"/rows.csv"]); got != "Name\nTask 1\n" {
+		t.Errorf("rows.csv = %q", got)
+	}
+}
+
+func TestScanRowsResolveUsersOnce(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	other := m.AddDatabase(f.page, "Bugs")
+	rows := []string{f.row, m.AddRow(other, "Bug 1"), m.AddRow(f.database, "Draft")}
+	for _, db := range []string{f.database, other} {
+		m.SetProperty(db, "Owner", map[string]any{"id": "owner", "name": "Owner", "type": "people", "people": map[string]any{}})
+	}
+	for _, row := range rows {
+		m.SetProperty(row, "Owner", map[string]any{"type": "people", "people": []any{map[string]any{"object": "user", "id": "user-1"}}})
+	}
+
+	files := scanSnapshot(t, newTestImporter(t, m, map[string]string{"csv": "true", "exclude": "title:Draft"}))
+
+	if got := string(files["/"+f.page+"/"+f.database+"/rows.csv"]); got != "Name,Owner\nTask 1,Ada\n" {
+		t.Errorf("rows.csv = %q", got)
+	}
+	if got := string(files["/"+f.page+"/"+other+"/rows.csv"]); got != "Name,Owner\nBug 1,Ada\n" {
+		t.Errorf("rows.csv = %q", got)
+	}
+	// once for the capability check, once for users.json and the rows
+	if got := m.Lists("users"); got != 2 {
+		t.Errorf("users listed %d times, expected 2", got)
+	}
+}
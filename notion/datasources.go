@@ -0,0 +1,265 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+// Since API version 2025-09-03 a database is a container of data sources,
+// each with its own schema and rows. The search returns the data sources,
+// whose parent is their database, and rows have a data_source_id parent.
+// A snapshot then holds a database.json per database and, below it, a
+// directory per data source with its data_source.json and its rows.
+
+// addDatabaseOf adds to the tree the database holding a data source, which
+// the search doesn't return on its own. The data sources of a database can
+// come in different search pages, the database is only fetched once.
+func (p *NotionImporter) addDatabaseOf(source Page, results chan<- *importer.ScanResult) {
+	databaseID, _ := source.Parent["database_id"].(string)
+	if databaseID == "" {
+		return
+	}
+	p.databases.Lock()
+	defer p.databases.Unlock()
+	if p.tree.known(databaseID) {
+		return
+	}
+
+	database := Page{Object: "database", ID: databaseID, Parent: source.DatabaseParent}
+	raw, err := p.client.fetchFromURL(p.client.url("/databases/%s", databaseID))
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(raw); err == nil {
+			err = json.Unmarshal(data, &database)
+		}
+	}
+	if err != nil {
+		p.scanError(results, databaseID, fmt.Errorf("failed to fetch database: %w", err))
+	}
+	if database.Parent == nil {
+		database.Parent = map[string]any{"type": "workspace", "workspace": true}
+	}
+	p.AddPagesToTree([]Page{database}, results)
+}
+
+// addQueriedRows adds the rows the search left out, once its pages are in
+// the tree: the search only returns what its index holds, while a query
+// lists every row of a data source, or of a database before data sources.
+func (p *NotionImporter) addQueriedRows(results chan<- *importer.ScanResult) {
+	for _, entry := range p.tree.saved() {
+		var url string
+		switch {
+		case entry.page.Object == "data_source":
+			url = p.client.url("/data_sources/%s/query", entry.page.ID)
+		case entry.page.Object == "database" && !p.client.dataSources():
+			url = p.client.url("/databases/%s/query", entry.page.ID)
+		default:
+			continue
+		}
+		rows, err := p.client.queryRows(url)
+		if err != nil {
+			p.scanError(results, entry.path, fmt.Errorf("failed to query rows: %w", err))
+			continue
+		}
+		var missing []Page
+		for _, raw := range rows {
+			var row Page
+			data, err := json.Marshal(raw)
+			if err == nil {
+				err = json.Unmarshal(data, &row)
+			}
+			if err != nil {
+				p.scanError(results, entry.path, fmt.Errorf("failed to decode row: %w", err))
+				continue
+			}
+			if !p.tree.known(row.ID) {
+				missing = append(missing, row)
+			}
+		}
+		if len(missing) > 0 {
+			debugf("%d rows of %s %s not returned by the search", len(missing), entry.page.Object, entry.page.ID)
+			p.AddPagesToTree(missing, results)
+		}
+	}
+}
+
+// dataSourceDirs returns the directories of the data sources of the
+// database saved in dir, in the order of its data_sources list, the first
+// one being the one a database is created with.
+func dataSourceDirs(dir string, database map[string]any) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entries from %s: %w", dir, err)
+	}
+	rank := make(map[string]int)
+	sources, _ := database["data_sources"].([]any)
+	for i, source := range sources {
+		s, _ := source.(map[string]any)
+		if id, ok := s["id"].(string); ok {
+			rank[id] = i
+		}
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(path.Join(dir, entry.Name(), "data_source.json")); err == nil {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		ri, ok := rank[dirs[i]]
+		if !ok {
+			ri = len(sources)
+		}
+		rj, ok := rank[dirs[j]]
+		if !ok {
+			rj = len(sources)
+		}
+		return ri < rj
+	})
+	for i := range dirs {
+		dirs[i] = path.Join(dir, dirs[i])
+	}
+	return dirs, nil
+}
+
+// snapshotRows returns the schema of the database saved in dir and the
+// directories of its rows, relative to dir. The schemas and rows of its
+// data sources are merged.
+func snapshotRows(dir string, database map[string]any) (map[string]any, []string, error) {
+	schema := make(map[string]any)
+	if properties, ok := database["properties"].(map[string]any); ok {
+		for name, prop := range properties {
+			schema[name] = prop
+		}
+	}
+
+	var rows []string
+	var walk func(rel string, sources bool) error
+	walk = func(rel string, sources bool) error {
+		entries, err := os.ReadDir(path.Join(dir, rel))
+		if err != nil {
+			return fmt.Errorf("failed to read entries from %s: %w", path.Join(dir, rel), err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			name := path.Join(rel, entry.Name())
+			if _, err := os.Stat(path.Join(dir, name, "page.json")); err == nil {
+				rows = append(rows, name)
+				continue
+			}
+			if !sources {
+				continue
+			}
+			source, err := loadJSONFromFile(path.Join(dir, name, "data_source.json"))
+			if err != nil {
+				continue
+			}
+			properties, _ := source["properties"].(map[string]any)
+			for name, prop := range properties {
+				if _, ok := schema[name]; !ok {
+					schema[name] = prop
+				}
+			}
+			if err := walk(name, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk("", true); err != nil {
+		return nil, nil, err
+	}
+	return schema, rows, nil
+}
+
+// isRowParent reports whether a parent of type parentType makes a page a
+// database row, with properties following the schema of its parent.
+func isRowParent(parentType any) bool {
+	return parentType == "database_id" || parentType == "data_source_id"
+}
+
+// exportDataSources creates the database saved in dir with the data
+// sources of the snapshot, the first one along with the database and the
+// others afterwards. An API version without data sources only gets the
+// first one.
+func (n *NotionExporter) exportDataSources(payload map[string]any, dir string, sources []string) error {
+	first, err := loadJSONFromFile(path.Join(sources[0], "data_source.json"))
+	if err != nil {
+		return err
+	}
+	payload["properties"] = first["properties"]
+
+	databaseID, err := n.createDatabaseWithEntries(payload, sources[0])
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range sources[1:] {
+		source, err := loadJSONFromFile(path.Join(dir, "data_source.json"))
+		if err != nil {
+			return err
+		}
+		if !n.client.dataSources() {
+			warnf("skipping data source %q of database %q: API version %s has no data sources", titleOf(source), titleOf(payload), n.client.version)
+			n.plan.transform("data source skipped")
+			continue
+		}
+
+		data, err := json.Marshal(map[string]any{
+			"parent":     map[string]any{"type": "database_id", "database_id": databaseID},
+			"title":      source["title"],
+			"properties": source["properties"],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		dataSourceID, err := n.createDataSource(data)
+		if err != nil {
+			return err
+		}
+		debugf("created data source %s", dataSourceID)
+		if err := n.addEntries(dataSourceID, "data_source_id", dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *NotionExporter) createDataSource(payload []byte) (string, error) {
+	if n.plan != nil {
+		return n.plan.dataSource(), nil
+	}
+	jsonData, err := n.client.makeRequest("POST", n.client.url("/data_sources"), payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to create data source: %w", err)
+	}
+	n.progress.complete(kindDataSource, 1)
+	return jsonData["id"].(string), nil
+}
+
+// exportDataSourceFromFile restores a data source on its own, as a
+// database with that data source only.
+func (n *NotionExporter) exportDataSourceFromFile(pathname, parentType, parentID string) error {
+	source, err := loadJSONFromFile(pathname)
+	if err != nil {
+		return err
+	}
+	payload := map[string]any{
+		"parent":     map[string]any{"type": parentType, parentType: parentID},
+		"title":      source["title"],
+		"properties": source["properties"],
+	}
+	_, err = n.createDatabaseWithEntries(payload, path.Dir(pathname))
+	return err
+}
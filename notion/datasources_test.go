@@ -0,0 +1,99 @@
+package notion
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDataSourcesRoundTrip(t *testing.T) {
+	src := newMockNotion(t)
+	page := src.AddPage("workspace", "", "Spec")
+	database := src.AddDatabase(page, "Projects")
+	active := src.AddDataSource(database, "Active")
+	archive := src.AddDataSource(database, "Archive")
+	alpha := src.AddRow(active, "Alpha")
+	src.AddRow(archive, "Omega")
+
+	version := map[string]string{"api_version": DataSourcesVersion}
+	files := scanSnapshot(t, newTestImporter(t, src, map[string]string{"api_version": DataSourcesVersion, "csv": "true"}))
+
+	if got := decodeFile[manifest](t, files, "/manifest.json"); got.APIVersion != DataSourcesVersion {
+		t.Errorf("manifest API version = %q", got.APIVersion)
+	}
+	dbDir := "/" + page + "/" + database
+	decodeFile[map[string]any](t, files, dbDir+"/database.json")
+	source := decodeFile[map[string]any](t, files, dbDir+"/"+active+"/data_source.json")
+	if titleOf(source) != "Active" {
+		t.Errorf("data source title = %q", titleOf(source))
+	}
+	decodeFile[map[string]any](t, files, dbDir+"/"+active+"/"+alpha+"/page.json")
+	if got := string(files[dbDir+"/"+archive+"/rows.csv"]); got != "Name\nOmega\n" {
+		t.Errorf("rows.csv = %q", got)
+	}
+
+	// both data sources are restored with a data source API version
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, version)
+	restoreSnapshot(t, exp, files)
+	restored := childTitles(dst, root)["Spec"]
+	restoredDB := childTitles(dst, restored)["Projects"]
+	sources, _ := dst.Object(restoredDB)["data_sources"].([]any)
+	if len(sources) != 2 {
+		t.Fatalf("restored database has %d data sources, want 2", len(sources))
+	}
+	var rows []string
+	for _, s := range sources {
+		rows = append(rows, dst.Rows(s.(map[string]any)["id"].(string))...)
+	}
+	if !equalStrings(rows, []string{"Alpha", "Omega"}) {
+		t.Errorf("restored rows = %v", rows)
+	}
+
+	dir := t.TempDir()
+	writeSnapshot(t, files, dir)
+	config := map[string]string{"token": mockToken, "base_url": dst.baseURL(), "api_version": DataSourcesVersion, "rate_limit": "0"}
+	report, err := Verify(config, filepath.Join(dir, page), restored)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(report.Differences) != 0 || report.Pages != 3 {
+		t.Errorf("verify compared %d pages, differences: %v", report.Pages, report.Differences)
+	}
+
+	// an older API version only gets the first data source
+	old := newMockNotion(t)
+	root = old.AddPage("workspace", "", "Restore")
+	exp, stdout := newTestExporter(t, old, root, map[string]string{"dryrun": "true"})
+	restoreSnapshot(t, exp, files)
+	if !strings.Contains(stdout.String(), "data source skipped: 1") {
+		t.Errorf("plan does not report the skipped data source:\n%s", stdout)
+	}
+	exp, _ = newTestExporter(t, old, root, nil)
+	restoreSnapshot(t, exp, files)
+	restoredDB = childTitles(old, childTitles(old, root)["Spec"])["Projects"]
+	if rows := old.Rows(restoredDB); !equalStrings(rows, []string{"Alpha"}) {
+		t.Errorf("restored rows = %v", rows)
+	}
+}
+
+func TestScanQueriesDataSourceRows(t *testing.T) {
+	m := newMockNotion(t)
+	page := m.AddPage("workspace", "", "Spec")
+	database := m.AddDatabase(page, "Projects")
+	source := m.AddDataSource(database, "Active")
+	m.AddRow(source, "Alpha")
+	beta := m.AddRow(source, "Beta")
+	m.HideFromSearch(beta)
+	old := m.AddDatabase(page, "Tasks")
+	task := m.AddRow(old, "Task")
+	m.HideFromSearch(task)
+
+	files := scanSnapshot(t, newTestImporter(t, m, map[string]string{"api_version": DataSourcesVersion}))
+	decodeFile[map[string]any](t, files, "/"+page+"/"+database+"/"+source+"/"+beta+"/page.json")
+
+	// without data sources the databases are queried
+	files = scanSnapshot(t, newTestImporter(t, m, nil))
+	decodeFile[map[string]any](t, files, "/"+page+"/"+old+"/"+task+"/page.json")
+}
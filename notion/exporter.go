@@ -1,16 +1,16 @@
 package notion
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 
 	"github.com/PlakarKorp/kloset/objects"
 	"github.com/PlakarKorp/kloset/snapshot/exporter"
@@ -19,28 +19,36 @@ import (
 	"strings"
 )
 
-func DebugResponse(resp *http.Response) {
-	// debug
-	log.Printf("failed to upload file: %d", resp.StatusCode)
-	// Read the response body for more details
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
-	var prettyJSON bytes.Buffer
-	err = json.Indent(&prettyJSON, b, "", "\t")
-	if err != nil {
-		return
-	}
-	log.Printf("Error response: %s\n", prettyJSON.String())
-	// end
-}
-
 const tempDir = "/tmp/plakar-notion-restore"
 
+// Restore formats, set with the format option.
+const (
+	FormatNotion   = "notion"   // recreate the pages in a Notion workspace
+	FormatHTML     = "html"     // write a static HTML site to path
+	FormatMarkdown = "markdown" // write Markdown and CSV files to path
+)
+
 type NotionExporter struct {
-	token  string
+	format string
+	path   string // target directory of the local formats
+
+	client *client
 	rootID string //TODO : change this to a user friendly name (e.g. "My Notion Page" instead of "1234567890abcdef")
+
+	plan     *exportPlan // non-nil in dry-run mode, no API call is made
+	progress *progress   // nil in dry-run mode
+	stdout   io.Writer
+
+	commentAttribution bool
+	blockIDs           map[string]string // snapshot block ID -> restored block ID
+
+	mapUsers    bool
+	usersDenied bool              // the integration lacks the Read user information capability
+	users       map[string]User   // users of the snapshot, from users.json
+	userMap     map[string]string // snapshot user ID -> target user ID
+
+	keepArchived bool
+	archived     []archivedObject // restored objects to move back to the trash, in creation order
 }
 
 func normalizeUUID(id string) string {
@@ -58,20 +66,103 @@ func normalizeUUID(id string) string {
 }
 
 func NewNotionExporter(ctx context.Context, options *exporter.Options, name string, config map[string]string) (exporter.Exporter, error) {
-	token, ok := config["token"]
-	if !ok {
-		return nil, fmt.Errorf("missing token in config")
+	if err := setLogLevel(config); err != nil {
+		return nil, err
 	}
+
+	format := FormatNotion
+	if value, ok := config["format"]; ok {
+		switch value {
+		case FormatNotion, FormatHTML, FormatMarkdown:
+			format = value
+		default:
+			return nil, fmt.Errorf("invalid format value %q: must be %q, %q or %q", value, FormatNotion, FormatHTML, FormatMarkdown)
+		}
+	}
+	if format != FormatNotion {
+		// local formats don't call the Notion API
+		target, ok := config["path"]
+		if !ok {
+			return nil, fmt.Errorf("missing path in config for format %q", format)
+		}
+		return &NotionExporter{format: format, path: target, stdout: os.Stdout}, nil
+	}
+
 	rootID, ok := config["rootID"]
 	if !ok {
 		return nil, fmt.Errorf("missing rootID in config")
 	}
 	rootID = normalizeUUID(rootID)
 
-	return &NotionExporter{
-		token:  token,
+	n := &NotionExporter{
+		format: format,
 		rootID: rootID, //rootID must be an existing page ID, this is the page where the files will be exported
-	}, nil
+		stdout: os.Stdout,
+
+		blockIDs: make(map[string]string),
+	}
+	if options != nil && options.Stdout != nil {
+		n.stdout = options.Stdout
+	}
+
+	if attribution, ok := config["comment_attribution"]; ok {
+		enabled, err := strconv.ParseBool(attribution)
+		if err != nil {
+			return nil, fmt.Errorf("invalid comment_attribution value %q: %w", attribution, err)
+		}
+		n.commentAttribution = enabled
+	}
+
+	if mapUsers, ok := config["map_users"]; ok {
+		enabled, err := strconv.ParseBool(mapUsers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map_users value %q: %w", mapUsers, err)
+		}
+		n.mapUsers = enabled
+	}
+
+	if keepArchived, ok := config["keep_archived"]; ok {
+		enabled, err := strconv.ParseBool(keepArchived)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keep_archived value %q: %w", keepArchived, err)
+		}
+		n.keepArchived = enabled
+	}
+
+	if dryRun, ok := config["dryrun"]; ok {
+		enabled, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dryrun value %q: %w", dryRun, err)
+		}
+		if enabled {
+			n.plan = newExportPlan()
+		}
+	}
+
+	// a dry run makes no API call at all, nor reads or refreshes the token
+	if n.plan != nil {
+		client, err := newOfflineClient(config)
+		if err != nil {
+			return nil, err
+		}
+		n.client = client
+		return n, nil
+	}
+
+	client, err := newClientFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	n.client = client
+	n.progress, err = newProgress(ctx, config, "restore", "created")
+	if err != nil {
+		return nil, err
+	}
+	client.progress = n.progress
+	if err := n.checkAccess(); err != nil {
+		return nil, err
+	}
+	return n, nil
 }
 
 func (n *NotionExporter) Root(ctx context.Context) (string, error) {
@@ -108,66 +199,74 @@ func (n *NotionExporter) CreateLink(ctx context.Context, oldname string, newname
 }
 
 func (n *NotionExporter) Close(ctx context.Context) error {
-	err := n.export()
+	defer n.client.close()
+
+	err := n.checkManifest()
 	if err != nil {
-		log.Printf("failed to close exporter %v", err)
 		return fmt.Errorf("failed to export: %w", err)
 	}
-	return os.RemoveAll(tempDir)
-}
-
-func (n *NotionExporter) makeRequest(method, url string, payload []byte) (map[string]any, error) {
-	req, err := http.NewRequest(method, url, io.NopCloser(bytes.NewReader(payload)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	switch n.format {
+	case FormatHTML:
+		err = n.exportSite()
+	case FormatMarkdown:
+		err = n.exportMarkdown()
+	default:
+		err = n.export()
 	}
-	req.Header.Set("Authorization", "Bearer "+n.token)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Notion-Version", NotionVersionHeader)
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		DebugResponse(resp)
-		return nil, fmt.Errorf("request failed: status code %d", resp.StatusCode)
+		errorf("failed to close exporter: %v", err)
+		return fmt.Errorf("failed to export: %w", err)
 	}
-	jsonData := map[string]any{}
-	err = json.NewDecoder(resp.Body).Decode(&jsonData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if n.plan != nil {
+		n.plan.print(n.stdout)
 	}
-
-	return jsonData, nil
+	return os.RemoveAll(tempDir)
 }
 
 func (n *NotionExporter) createPage(payload []byte) (string, error) {
-	url := fmt.Sprintf("%s/pages", NotionURL)
-	jsonData, err := n.makeRequest("POST", url, payload)
+	if n.plan != nil {
+		return n.plan.page(), nil
+	}
+	jsonData, err := n.client.makeRequest("POST", n.client.url("/pages"), payload)
 	if err != nil {
 		return "", err
 	}
+	n.progress.complete(kindPage, 1)
 	return jsonData["id"].(string), nil
 }
 
-func (n *NotionExporter) createDatabase(payload []byte) (string, error) {
-	url := fmt.Sprintf("%s/databases", NotionURL)
-	jsonData, err := n.makeRequest("POST", url, payload)
+// createDatabase creates a database and returns its ID and, with a data
+// source API version, the ID of its initial data source.
+func (n *NotionExporter) createDatabase(payload []byte) (string, string, error) {
+	if n.plan != nil {
+		if n.client.dataSources() {
+			return n.plan.database(), n.plan.fakeID(), nil
+		}
+		return n.plan.database(), "", nil
+	}
+	jsonData, err := n.client.makeRequest("POST", n.client.url("/databases"), payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to create database: %w", err)
+		return "", "", fmt.Errorf("failed to create database: %w", err)
 	}
-	return jsonData["id"].(string), nil
+	n.progress.complete(kindDatabase, 1)
+	dataSourceID := ""
+	if sources, ok := jsonData["data_sources"].([]any); ok && len(sources) > 0 {
+		source, _ := sources[0].(map[string]any)
+		dataSourceID, _ = source["id"].(string)
+		n.progress.complete(kindDataSource, 1)
+	}
+	return jsonData["id"].(string), dataSourceID, nil
 }
 
 func (n *NotionExporter) addBlock(payload []byte, pageID string) (string, error) {
-	url := fmt.Sprintf("%s/blocks/%s/children", NotionURL, pageID)
-	jsonData, err := n.makeRequest("PATCH", url, payload)
+	if n.plan != nil {
+		return n.plan.block(), nil
+	}
+	jsonData, err := n.client.makeRequest("PATCH", n.client.url("/blocks/%s/children", pageID), payload)
 	if err != nil {
 		return "", err
 	}
+	n.progress.complete(kindBlock, 1)
 	blockID := jsonData["results"].([]any)[0].(map[string]any)["id"].(string) // considering blocks are added one by one
 	//TODO: considering to handle multiple blocks in the future to avoid too many requests
 	return blockID, nil
@@ -204,36 +303,75 @@ func preparePayload(payload map[string]any, parentType, parentID string) (cleane
 		"type":     parentType,
 		parentType: parentID,
 	}
+
+	// A database row restored on its own ends up under a page, which only
+	// accepts a title property.
+	if !isRowParent(parentType) {
+		payload["properties"] = titleOnlyProperties(payload["properties"])
+	}
 	return payload, children, nil
 }
 
+// titleOnlyProperties keeps the title property of a page, stored under the
+// "title" key as expected for pages whose parent is not a database.
+func titleOnlyProperties(properties any) map[string]any {
+	props, _ := properties.(map[string]any)
+	for _, prop := range props {
+		if p, ok := prop.(map[string]any); ok && p["type"] == "title" {
+			return map[string]any{"title": p}
+		}
+	}
+	return map[string]any{}
+}
+
 func (n *NotionExporter) createPageWithBlocks(payload map[string]any, children []map[string]any, pathTo string) error {
+	archived := takeArchived(payload)
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
-	log.Printf("Creating page with data: %s", string(data))
+	debugf("creating page with data: %s", data)
 
 	newPageID, err := n.createPage(data)
 	if err != nil {
 		return fmt.Errorf("failed to create page: %w", err)
 	}
-	log.Printf("Created page with ID: %s", newPageID)
+	debugf("created page %s", newPageID)
+	if archived {
+		n.restoredArchived("pages", newPageID)
+	}
 
-	return n.addAllBlocks(children, newPageID, pathTo)
+	if err := n.addAllBlocks(children, newPageID, pathTo); err != nil {
+		return err
+	}
+	return n.restoreComments(pathTo, "page_id", newPageID)
 }
 
-func (n *NotionExporter) createDatabaseWithEntries(payload map[string]any, dbPath string) error {
+// createDatabaseWithEntries creates a database with the schema in payload
+// and the rows saved in dbPath, and returns its ID. With a data source API
+// version, the schema goes to the initial data source, which holds the rows.
+func (n *NotionExporter) createDatabaseWithEntries(payload map[string]any, dbPath string) (string, error) {
+	archived := takeArchived(payload)
+	if n.client.dataSources() {
+		payload["initial_data_source"] = map[string]any{"properties": payload["properties"]}
+		delete(payload, "properties")
+	}
 	data, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
 	}
-	newDatabaseID, err := n.createDatabase(data)
+	newDatabaseID, dataSourceID, err := n.createDatabase(data)
 	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
+		return "", fmt.Errorf("failed to create database: %w", err)
+	}
+	debugf("created database %s", newDatabaseID)
+	if archived {
+		n.restoredArchived("databases", newDatabaseID)
 	}
-	log.Printf("Created database with ID: %s", newDatabaseID)
-	return n.addEntries(newDatabaseID, dbPath)
+	if dataSourceID != "" {
+		return newDatabaseID, n.addEntries(dataSourceID, "data_source_id", dbPath)
+	}
+	return newDatabaseID, n.addEntries(newDatabaseID, "database_id", dbPath)
 }
 
 func (n *NotionExporter) exportPageFromFile(pathname, parentType, parentID string) error {
@@ -241,10 +379,17 @@ func (n *NotionExporter) exportPageFromFile(pathname, parentType, parentID strin
 	if err != nil {
 		return err
 	}
+	if parent, ok := payload["parent"].(map[string]any); ok && isRowParent(parent["type"]) && !isRowParent(parentType) {
+		n.plan.transform("database row restored as a page")
+	}
 	payload, children, err := preparePayload(payload, parentType, parentID)
 	if err != nil {
 		return err
 	}
+	n.mapPeople(payload["properties"])
+	if err := n.restoreMedia(payload, path.Dir(pathname)); err != nil {
+		return err
+	}
 	return n.createPageWithBlocks(payload, children, path.Dir(pathname))
 }
 
@@ -254,13 +399,26 @@ func (n *NotionExporter) exportDatabaseFromFile(pathname, parentType, parentID s
 		return err
 	}
 
+	sources, err := dataSourceDirs(path.Dir(pathname), payload)
+	if err != nil {
+		return err
+	}
+
 	delete(payload, "id")
+	delete(payload, "data_sources")
 	payload["parent"] = map[string]any{
 		"type":     parentType,
 		parentType: parentID,
 	}
+	if err := n.restoreMedia(payload, path.Dir(pathname)); err != nil {
+		return err
+	}
 
-	return n.createDatabaseWithEntries(payload, path.Dir(pathname))
+	if len(sources) > 0 {
+		return n.exportDataSources(payload, path.Dir(pathname), sources)
+	}
+	_, err = n.createDatabaseWithEntries(payload, path.Dir(pathname))
+	return err
 }
 
 func (n *NotionExporter) addAllBlocks(jsonData []map[string]any, newID, pathTo string) error {
@@ -268,6 +426,7 @@ func (n *NotionExporter) addAllBlocks(jsonData []map[string]any, newID, pathTo s
 		dir := path.Join(pathTo, block["id"].(string))
 
 		if block["type"] == "image" { //TODO: handle images, and other more block types
+			n.plan.skip("image")
 			continue
 		}
 
@@ -295,24 +454,12 @@ func (n *NotionExporter) addAllBlocks(jsonData []map[string]any, newID, pathTo s
 			if err != nil {
 				return fmt.Errorf("failed to patch block: %w", err)
 			}
+			n.blockIDs[block["id"].(string)] = newBlockId
 
 			if block["type"] == "toggle" {
-				pathname := path.Join(dir, "blocks.json")
-				f, err := os.Open(pathname)
+				err := n.exportBlocksFromFile(path.Join(dir, "blocks.json"), "block_id", newBlockId)
 				if err != nil {
-					return fmt.Errorf("failed to open %s: %w", pathname, err)
-				}
-				defer f.Close()
-
-				var data []map[string]any
-				if err := json.NewDecoder(f).Decode(&data); err != nil {
-					return fmt.Errorf("failed to decode JSON from %s: %w", pathname, err)
-				}
-				if len(data) > 0 {
-					err = n.addAllBlocks(data, newBlockId, path.Dir(pathname))
-					if err != nil {
-						return fmt.Errorf("failed to add toggle children: %w", err)
-					}
+					return fmt.Errorf("failed to add toggle children: %w", err)
 				}
 			}
 		}
@@ -320,7 +467,29 @@ func (n *NotionExporter) addAllBlocks(jsonData []map[string]any, newID, pathTo s
 	return nil
 }
 
-func (n *NotionExporter) addEntries(newID, pathTo string) error {
+func (n *NotionExporter) exportBlocksFromFile(pathname, parentType, parentID string) error {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", pathname, err)
+	}
+	defer f.Close()
+
+	var data []map[string]any
+	if err := json.NewDecoder(f).Decode(&data); err != nil {
+		return fmt.Errorf("failed to decode JSON from %s: %w", pathname, err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := n.addAllBlocks(data, parentID, path.Dir(pathname)); err != nil {
+		return err
+	}
+	return n.restoreComments(path.Dir(pathname), parentType, parentID)
+}
+
+// addEntries restores the rows saved in pathTo into the database or data
+// source newID, parentType telling which.
+func (n *NotionExporter) addEntries(newID, parentType, pathTo string) error {
 	entries, err := os.ReadDir(pathTo)
 	if err != nil {
 		return fmt.Errorf("failed to read entries from %s: %w", pathTo, err)
@@ -331,7 +500,7 @@ func (n *NotionExporter) addEntries(newID, pathTo string) error {
 		}
 		dir := path.Join(pathTo, entry.Name())
 
-		err := n.exportPageFromFile(path.Join(dir, "page.json"), "database_id", newID)
+		err := n.exportPageFromFile(path.Join(dir, "page.json"), parentType, newID)
 		if err != nil {
 			return fmt.Errorf("failed to export page: %w", err)
 		}
@@ -339,36 +508,116 @@ func (n *NotionExporter) addEntries(newID, pathTo string) error {
 	return nil
 }
 
+// restoreRoot is a directory of the restored tree that is not nested in
+// another restorable object, and therefore has to be attached to rootID.
+type restoreRoot struct {
+	dir    string
+	object string // "page", "database", "data_source" or "blocks"
+}
+
+// findRestoreRoots walks the restored tree and returns the topmost page,
+// database and block directories. This does not rely on content.json so
+// that restoring a subpath of a snapshot works as well as a full restore.
+func findRestoreRoots(root string) ([]restoreRoot, error) {
+	var roots []restoreRoot
+	err := filepath.WalkDir(root, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		for _, candidate := range []struct{ file, object string }{
+			{"page.json", "page"},
+			{"database.json", "database"},
+			{"data_source.json", "data_source"},
+			{"blocks.json", "blocks"},
+		} {
+			if _, err := os.Stat(path.Join(pathname, candidate.file)); err == nil {
+				roots = append(roots, restoreRoot{dir: pathname, object: candidate.object})
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+	return roots, nil
+}
+
+// countObjects counts the pages, databases and data sources to restore,
+// for the progress reports.
+func (n *NotionExporter) countObjects() error {
+	if n.progress == nil {
+		return nil
+	}
+	return filepath.WalkDir(tempDir, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch d.Name() {
+		case "page.json", "database.json", "data_source.json":
+			n.progress.discover(strings.TrimSuffix(d.Name(), ".json"))
+		}
+		return nil
+	})
+}
+
 func (n *NotionExporter) export() error {
-	pathname := path.Join(tempDir, "content.json")
-	file, err := os.Open(pathname)
+	roots, err := findRestoreRoots(tempDir)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", pathname, err)
+		return err
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("nothing to restore: no page, database or blocks found")
 	}
-	defer file.Close()
 
-	var jsonData []map[string]any
-	if err := json.NewDecoder(file).Decode(&jsonData); err != nil {
-		return fmt.Errorf("failed to decode JSON from file %s: %w", pathname, err)
+	if n.plan == nil {
+		if err := n.client.metrics.serve(); err != nil {
+			return err
+		}
 	}
+	if err := n.countObjects(); err != nil {
+		return err
+	}
+	n.progress.start()
+	defer n.progress.finish()
 
-	for _, entry := range jsonData {
-		dir := path.Join(tempDir, entry["id"].(string))
+	if err := n.loadSnapshotUsers(); err != nil {
+		return err
+	}
+	if n.mapUsers {
+		n.userMap = make(map[string]string)
+		if err := n.buildUserMap(); err != nil {
+			return fmt.Errorf("failed to map users: %w", err)
+		}
+	}
 
-		if entry["object"] == "page" {
-			err := n.exportPageFromFile(path.Join(dir, "page.json"), "page_id", n.rootID)
+	for _, root := range roots {
+		switch root.object {
+		case "page":
+			err := n.exportPageFromFile(path.Join(root.dir, "page.json"), "page_id", n.rootID)
 			if err != nil {
 				return fmt.Errorf("failed to export page: %w", err)
 			}
-
-		} else if entry["object"] == "database" {
-			err := n.exportDatabaseFromFile(path.Join(dir, "database.json"), "page_id", n.rootID)
+		case "database":
+			err := n.exportDatabaseFromFile(path.Join(root.dir, "database.json"), "page_id", n.rootID)
 			if err != nil {
 				return fmt.Errorf("failed to export database: %w", err)
 			}
-		} else {
-			return fmt.Errorf("unsupported object type: %s", entry["object"])
+		case "data_source":
+			err := n.exportDataSourceFromFile(path.Join(root.dir, "data_source.json"), "page_id", n.rootID)
+			if err != nil {
+				return fmt.Errorf("failed to export data source: %w", err)
+			}
+		case "blocks":
+			err := n.exportBlocksFromFile(path.Join(root.dir, "blocks.json"), "page_id", n.rootID)
+			if err != nil {
+				return fmt.Errorf("failed to export blocks: %w", err)
+			}
 		}
 	}
-	return nil
+	return n.archiveRestored()
 }
@@ -0,0 +1,200 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/kloset/snapshot/exporter"
+)
+
+func newTestExporter(t *testing.T, m *mockNotion, rootID string, config map[string]string) (exporter.Exporter, *bytes.Buffer) {
+	t.Helper()
+	os.RemoveAll(tempDir)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	cfg := map[string]string{"token": mockToken, "base_url": m.baseURL(), "rootID": rootID, "rate_limit": "0"}
+	for k, v := range config {
+		cfg[k] = v
+	}
+	stdout := new(bytes.Buffer)
+	exp, err := NewNotionExporter(context.Background(), &exporter.Options{Stdout: stdout}, "notion", cfg)
+	if err != nil {
+		t.Fatalf("NewNotionExporter: %v", err)
+	}
+	return exp, stdout
+}
+
+// restoreSnapshot feeds files to an exporter the way plakar restores a
+// snapshot, parents first, then closes it to run the export.
+func restoreSnapshot(t *testing.T, exp exporter.Exporter, files map[string][]byte) {
+	t.Helper()
+	ctx := context.Background()
+
+	pathnames := make([]string, 0, len(files))
+	for pathname := range files {
+		pathnames = append(pathnames, pathname)
+	}
+	sort.Strings(pathnames)
+
+	for _, pathname := range pathnames {
+		if err := exp.CreateDirectory(ctx, path.Dir(pathname)); err != nil {
+			t.Fatalf("CreateDirectory %s: %v", path.Dir(pathname), err)
+		}
+		data := files[pathname]
+		if err := exp.StoreFile(ctx, pathname, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("StoreFile %s: %v", pathname, err)
+		}
+	}
+	if err := exp.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// subtree returns the files of a snapshot under prefix.
+func subtree(files map[string][]byte, prefix string) map[string][]byte {
+	sub := make(map[string][]byte)
+	for pathname, data := range files {
+		if strings.HasPrefix(pathname, prefix+"/") {
+			sub[pathname] = data
+		}
+	}
+	return sub
+}
+
+// childTitles maps the titles of the child pages and databases of a page in
+// the mock to their IDs.
+func childTitles(m *mockNotion, id string) map[string]string {
+	titles := make(map[string]string)
+	for _, block := range m.Children(id) {
+		switch block["type"] {
+		case "child_page":
+			titles[block["child_page"].(map[string]any)["title"].(string)] = block["id"].(string)
+		case "child_database":
+			titles[block["child_database"].(map[string]any)["title"].(string)] = block["id"].(string)
+		}
+	}
+	return titles
+}
+
+func TestExportSelectiveRestoreOfAPage(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, nil)
+	restoreSnapshot(t, exp, subtree(files, "/"+f.page+"/"+f.child))
+
+	titles := childTitles(dst, root)
+	if len(titles) != 1 || titles["Child"] == "" {
+		t.Fatalf("expected only Child under the root, got %v", titles)
+	}
+	children := dst.Children(titles["Child"])
+	if len(children) != 1 || children[0]["type"] != "paragraph" {
+		t.Fatalf("unexpected restored children: %v", children)
+	}
+}
+
+func TestExportSelectiveRestoreOfARow(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, nil)
+	restoreSnapshot(t, exp, subtree(files, "/"+f.page+"/"+f.database+"/"+f.row))
+
+	titles := childTitles(dst, root)
+	if titles["Task 1"] == "" {
+		t.Fatalf("row not restored as a page, got %v", titles)
+	}
+	row := dst.Object(titles["Task 1"])
+	if _, ok := row["properties"].(map[string]any)["title"]; !ok {
+		t.Fatalf("row restored without a title property: %v", row["properties"])
+	}
+}
+
+func TestExportDryRunMakesNoRequest(t *testing.T) {
+	src := newMockNotion(t)
+	newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, stdout := newTestExporter(t, dst, root, map[string]string{"dryrun": "true"})
+	restoreSnapshot(t, exp, files)
+
+	if n := dst.requestCount(); n != 0 {
+		t.Errorf("dry run made %d requests", n)
+	}
+	plan := stdout.String()
+	for _, want := range []string{"pages:        3", "databases:    1", "files:        1", "image: 1"} {
+		if !strings.Contains(plan, want) {
+			t.Errorf("plan is missing %q:\n%s", want, plan)
+		}
+	}
+}
+
+func TestExportDryRunKeepsCredentials(t *testing.T) {
+	src := newMockNotion(t)
+	newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	dst.EnableOAuth("refresh-0")
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "refresh_token")
+	if err := os.WriteFile(tokenFile, []byte("refresh-0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmdFile := filepath.Join(dir, "stored")
+	// serving the metrics would fail on an address in use
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	os.RemoveAll(tempDir)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+	exp, err := NewNotionExporter(context.Background(), &exporter.Options{Stdout: new(bytes.Buffer)}, "notion", map[string]string{
+		"base_url":           dst.baseURL(),
+		"rootID":             root,
+		"client_id":          mockClientID,
+		"client_secret":      mockClientSecret,
+		"refresh_token_file": tokenFile,
+		"refresh_token_cmd":  "cat > " + cmdFile,
+		"metrics_listen":     busy.Addr().String(),
+		"dryrun":             "true",
+	})
+	if err != nil {
+		t.Fatalf("NewNotionExporter: %v", err)
+	}
+	restoreSnapshot(t, exp, files)
+
+	if _, grants := dst.RefreshToken(); grants != 0 {
+		t.Errorf("dry run refreshed the access token %d times", grants)
+	}
+	if data, err := os.ReadFile(tokenFile); err != nil || string(data) != "refresh-0\n" {
+		t.Errorf("dry run rewrote refresh_token_file: %q, %v", data, err)
+	}
+	if _, err := os.Stat(cmdFile); !os.IsNotExist(err) {
+		t.Errorf("dry run ran refresh_token_cmd")
+	}
+}
+
+func TestNewNotionExporterRequiresRootID(t *testing.T) {
+	_, err := NewNotionExporter(context.Background(), &exporter.Options{}, "notion", map[string]string{"token": mockToken})
+	if err == nil || !strings.Contains(err.Error(), "rootID") {
+		t.Fatalf("expected a missing rootID error, got %v", err)
+	}
+}
@@ -1,10 +1,7 @@
 package notion
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strings"
@@ -15,8 +12,6 @@ import (
 	"github.com/PlakarKorp/kloset/snapshot/importer"
 )
 
-const notionSearchURL = NotionURL + "/search"
-
 type SearchResponse struct {
 	Results    []Page `json:"results"`
 	HasMore    bool   `json:"has_more"`
@@ -27,16 +22,23 @@ type Page struct {
 	Object string         `json:"object"`
 	ID     string         `json:"id"`
 	Parent map[string]any `json:"parent"` // Parent can be a page, block, or workspace (string, string, or boolean)
-	//Properties struct {
-	//	Title struct {
-	//		Title []struct {
-	//			Text struct {
-	//				Content string `json:"content"` // The title text (later used to create the displayed name)
-	//			} `json:"text"`
-	//		} `json:"title"`
-	//	} `json:"title"`
-	//} `json:"properties"`
-	//Other properties can be added here as needed
+	Icon   map[string]any `json:"icon,omitempty"`
+	Cover  map[string]any `json:"cover,omitempty"`
+	// Properties of a page or schema of a database, and title of a database.
+	Properties map[string]any `json:"properties,omitempty"`
+	Title      []any          `json:"title,omitempty"`
+	// Parent of the database holding a data source.
+	DatabaseParent map[string]any `json:"database_parent,omitempty"`
+	Archived       bool           `json:"archived,omitempty"`
+	InTrash        bool           `json:"in_trash,omitempty"`
+}
+
+// media returns the icon or cover of the page.
+func (pg Page) media(key string) map[string]any {
+	if key == "cover" {
+		return pg.Cover
+	}
+	return pg.Icon
 }
 
 type PageInfo struct {
@@ -46,28 +48,21 @@ type PageInfo struct {
 
 func (p *NotionImporter) fetchAllPages(cursor string, results chan<- *importer.ScanResult, wg *sync.WaitGroup) error {
 	bodyMap := map[string]interface{}{
-		"page_size": PageSize,
+		"page_size": p.client.pageSize,
 	}
 	if cursor != "" {
 		bodyMap["start_cursor"] = cursor
 	}
 	bodyJSON, _ := json.Marshal(bodyMap)
 
-	req, err := http.NewRequest("POST", notionSearchURL, bytes.NewBuffer(bodyJSON))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+p.token)
-	req.Header.Set("Notion-Version", NotionVersionHeader)
-
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.client.do("POST", p.client.url("/search"), "application/json", bodyJSON)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("notion returned status code %d", resp.StatusCode)
+		return p.client.apiError(p.client.url("/search"), resp)
 	}
 
 	var response SearchResponse
@@ -79,7 +74,7 @@ func (p *NotionImporter) fetchAllPages(cursor string, results chan<- *importer.S
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		p.AddPagesToTree(response.Results, results, &(p.nReader))
+		p.AddPagesToTree(response.Results, results)
 	}()
 
 	if response.HasMore {
@@ -94,87 +89,238 @@ type PageNode struct {
 	Children        []*PageNode
 	Parent          *PageNode
 	ConnectedToRoot bool
+	Saved           bool // connected and selected by the filters, not only a directory
+	Excluded        bool // skipped with its descendants by the exclude option
+}
+
+// pageTree holds the pages, databases and blocks found by a scan, linked to
+// their parents. It is changed by the search goroutines and the scan loop
+// while plakar calls the readers in parallel, so it is only used with mu
+// held, or through the accessors below.
+type pageTree struct {
+	mu       sync.Mutex
+	nodes    map[string]*PageNode   // PageID -> PageNode
+	waiting  map[string][]*PageNode // ParentID -> []*PageNode
+	topLevel map[string]string      // Top-level pages (id -> type)
+}
+
+func newPageTree() *pageTree {
+	return &pageTree{
+		nodes:    make(map[string]*PageNode),
+		waiting:  make(map[string][]*PageNode),
+		topLevel: make(map[string]string),
+	}
+}
+
+// treeEntry is a copy of a node of the tree, with its path in the
+// snapshot.
+type treeEntry struct {
+	page Page
+	path string
+}
+
+// known reports whether id is in the tree.
+func (t *pageTree) known(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.nodes[id]
+	return ok
+}
+
+// page returns the page, database or block id.
+func (t *pageTree) page(id string) (Page, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node, ok := t.nodes[id]
+	if !ok {
+		return Page{}, false
+	}
+	return node.Page, true
+}
+
+// children returns the database or page id and its saved child pages.
+func (t *pageTree) children(id string) (Page, []Page, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node, ok := t.nodes[id]
+	if !ok {
+		return Page{}, nil, false
+	}
+	var children []Page
+	for _, child := range node.Children {
+		if child.Page.Object == "page" && child.Saved {
+			children = append(children, child.Page)
+		}
+	}
+	return node.Page, children, true
+}
+
+// saved returns the pages, databases and data sources saved by the scan.
+func (t *pageTree) saved() []treeEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var entries []treeEntry
+	for _, node := range t.nodes {
+		if node.Saved {
+			entries = append(entries, treeEntry{page: node.Page, path: GetPathToRoot(node)})
+		}
+	}
+	return entries
 }
 
-// Global maps //TODO change global variables to struct fields
-var nodeMap = make(map[string]*PageNode)           // PageID -> PageNode
-var waitingChildren = make(map[string][]*PageNode) // ParentID -> []*PageNode
-var topLevelPages = make(map[string]string)        // Top-level pages (id -> type)
+// topLevelPages returns the top-level pages, ID -> object type.
+func (t *pageTree) topLevelPages() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pages := make(map[string]string, len(t.topLevel))
+	for id, typ := range t.topLevel {
+		pages[id] = typ
+	}
+	return pages
+}
+
+// waitingParents returns the parents that pages are waiting for, ID ->
+// parent type.
+func (t *pageTree) waitingParents() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parents := make(map[string]string, len(t.waiting))
+	for parentID, nodes := range t.waiting {
+		parentType, _ := nodes[0].Page.Parent["type"].(string)
+		parents[parentID] = parentType
+	}
+	return parents
+}
 
-func (p *NotionImporter) AddPagesToTree(pages []Page, results chan<- *importer.ScanResult, nReader *int) {
+// AddPagesToTree adds pages to the tree, and sends the records of those
+// connected to the root. The records are sent once the tree is unlocked,
+// as plakar may be waiting on a reader that needs it.
+func (p *NotionImporter) AddPagesToTree(pages []Page, results chan<- *importer.ScanResult) {
 	for _, page := range pages {
-		id := page.ID
-		parentID, ok := page.Parent[page.Parent["type"].(string)].(string)
-		if !ok {
-			parentID = ""
+		if page.Object == "data_source" {
+			p.addDatabaseOf(page, results)
 		}
+	}
 
-		// Get or create the node
-		node, exists := nodeMap[id]
-		if !exists {
-			node = &PageNode{Page: page}
-			nodeMap[id] = node
-		} else {
-			node.Page = page
+	var records []*importer.ScanResult
+	p.tree.mu.Lock()
+	for _, page := range pages {
+		p.addPageLocked(page, &records)
+	}
+	p.tree.mu.Unlock()
+
+	for _, record := range records {
+		results <- record
+	}
+}
+
+func (p *NotionImporter) addPageLocked(page Page, records *[]*importer.ScanResult) {
+	t := p.tree
+	id := page.ID
+	parentID, ok := page.Parent[page.Parent["type"].(string)].(string)
+	if !ok || id == p.scope {
+		parentID = ""
+	}
+
+	// Get or create the node
+	node, exists := t.nodes[id]
+	if !exists {
+		node = &PageNode{Page: page}
+		t.nodes[id] = node
+	} else {
+		node.Page = page
+	}
+
+	// Determine if it's a root node
+	if parentID == "" {
+		// Top-level page, only the root of the scope when there is one
+		if p.scope == "" || id == p.scope {
+			t.topLevel[id] = page.Object // Store id -> type
+			p.propagateConnectionToRoot(node, records)
 		}
+	} else {
+		if parent, ok := t.nodes[parentID]; ok {
+			// Attach to parent
+			node.Parent = parent
+			parent.Children = append(parent.Children, node)
 
-		// Determine if it's a root node
-		if parentID == "" {
-			// Top-level page
-			topLevelPages[id] = page.Object // Store id -> type
-			p.propagateConnectionToRoot(node, results, nReader)
-		} else {
-			if parent, ok := nodeMap[parentID]; ok {
-				// Attach to parent
-				node.Parent = parent
-				parent.Children = append(parent.Children, node)
-
-				// Propagate connection if parent is already connected to root
-				if parent.ConnectedToRoot {
-					p.propagateConnectionToRoot(node, results, nReader)
-				}
-			} else {
-				// Parent not yet known; defer
-				waitingChildren[parentID] = append(waitingChildren[parentID], node)
+			// Propagate connection if parent is already connected to root
+			if parent.ConnectedToRoot {
+				p.propagateConnectionToRoot(node, records)
 			}
+		} else {
+			// Parent not yet known; defer
+			t.waiting[parentID] = append(t.waiting[parentID], node)
 		}
+	}
 
-		// Check if this node has waiting children
-		if children, ok := waitingChildren[id]; ok {
-			for _, child := range children {
-				child.Parent = node
-				node.Children = append(node.Children, child)
+	// Check if this node has waiting children
+	if children, ok := t.waiting[id]; ok {
+		for _, child := range children {
+			child.Parent = node
+			node.Children = append(node.Children, child)
 
-				// Propagate root connection if current node is connected
-				if node.ConnectedToRoot {
-					p.propagateConnectionToRoot(child, results, nReader)
-				}
+			// Propagate root connection if current node is connected
+			if node.ConnectedToRoot {
+				p.propagateConnectionToRoot(child, records)
 			}
-			delete(waitingChildren, id)
 		}
+		delete(t.waiting, id)
 	}
 }
 
-func (p *NotionImporter) propagateConnectionToRoot(node *PageNode, results chan<- *importer.ScanResult, nReader *int) {
-	if node.ConnectedToRoot {
+// propagateConnectionToRoot connects node and its descendants to the root,
+// with the tree locked, and adds the records of what is saved to records.
+func (p *NotionImporter) propagateConnectionToRoot(node *PageNode, records *[]*importer.ScanResult) {
+	if node.ConnectedToRoot || node.Excluded {
+		return
+	}
+	if node.Page.Object != "block" && p.filter.excludes(node) {
+		debugf("excluding %s %s and its descendants", node.Page.Object, node.Page.ID)
+		node.Excluded = true
+		delete(p.tree.topLevel, node.Page.ID)
+		p.stats.exclude(objectType(node.Page))
 		return
 	}
 	node.ConnectedToRoot = true
 
 	if node.Page.Object != "block" {
+		*records = append(*records, importer.NewScanRecord(GetPathToRoot(node), "", objects.NewFileInfo(node.Page.ID, 0, os.ModeDir|0700, time.Time{}, 0, 0, 0, 0, 0), nil, nil))
+		node.Saved = p.filter.includes(node)
+	}
+
+	if node.Saved {
+		p.archive.push(relatedIDs(node.Page)...)
+		p.progress.discover(node.Page.Object)
+		if node.Page.Object == "page" {
+			p.prefetch.push(node.Page.ID)
+		}
 		pageName := node.Page.Object + ".json"
-		results <- importer.NewScanRecord(GetPathToRoot(node), "", objects.NewFileInfo(node.Page.ID, 0, os.ModeDir|0700, time.Time{}, 0, 0, 0, 0, 0), nil, nil)
-		results <- importer.NewScanRecord(GetPathToRoot(node)+"/"+pageName, "", objects.NewFileInfo(pageName, 0, 0, time.Time{}, 0, 0, 0, 0, 0), nil, func() (io.ReadCloser, error) {
-			return p.NewReader(GetPathToRoot(node) + "/" + pageName)
-		})
-		*nReader++
+		pagePath := GetPathToRoot(node) + "/" + pageName
+		*records = append(*records, p.fileRecord(pagePath, objects.NewFileInfo(pageName, 0, 0, time.Time{}, 0, 0, 0, 0, 0)))
+		p.nReader.Add(1)
+
+		// Notion-hosted icons and covers are saved next to the page or
+		// database, their URLs expire and can't be used to restore them.
+		for _, key := range mediaKeys {
+			mediaURL := hostedMediaURL(node.Page.media(key))
+			if mediaURL == "" {
+				continue
+			}
+			mediaName := mediaFileName(key, mediaURL)
+			mediaPath := GetPathToRoot(node) + "/" + mediaName
+			*records = append(*records, p.fileRecord(mediaPath, objects.NewFileInfo(mediaName, 0, 0700, time.Time{}, 0, 0, 0, 0, 0)))
+			p.stats.file()
+		}
 	}
 
 	for _, child := range node.Children {
-		p.propagateConnectionToRoot(child, results, nReader)
+		p.propagateConnectionToRoot(child, records)
 	}
 }
 
+// GetPathToRoot returns the path of node in the snapshot, with the tree
+// locked.
 func GetPathToRoot(node *PageNode) string {
 	var path []string
 	current := node
@@ -187,9 +333,3 @@ func GetPathToRoot(node *PageNode) string {
 
 	return "/" + strings.Join(path, "/")
 }
-
-func ClearNodeTree() {
-	nodeMap = make(map[string]*PageNode)
-	waitingChildren = make(map[string][]*PageNode)
-	topLevelPages = make(map[string]string)
-}
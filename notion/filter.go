@@ -0,0 +1,185 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filters select what a backup saves, with the include and exclude
+// options. Each holds comma-separated selectors:
+//
+//	id:<page or database ID>
+//	title:<glob matched against the title>
+//	path:<glob matched against the titles from the top, joined by "/">
+//	type:<page, row, database or data_source>
+//	block:<block type>, exclude only
+//
+// An excluded object is skipped with everything below it, before any of it
+// is fetched. With include, only the objects matching it and their
+// descendants are saved; the objects above them are only kept as
+// directories.
+type filter struct {
+	include []selector
+	exclude []selector
+}
+
+type selector struct {
+	key   string
+	value string
+}
+
+var selectorKeys = []string{"id", "title", "path", "type", "block"}
+
+// newFilter parses the include and exclude options of a connector
+// configuration.
+func newFilter(config map[string]string) (*filter, error) {
+	f := &filter{}
+	var err error
+	if f.include, err = parseSelectors("include", config["include"]); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = parseSelectors("exclude", config["exclude"]); err != nil {
+		return nil, err
+	}
+	for _, s := range f.include {
+		if s.key == "block" {
+			return nil, fmt.Errorf("invalid include value %q: block types can only be excluded", config["include"])
+		}
+	}
+	return f, nil
+}
+
+func parseSelectors(option, value string) ([]selector, error) {
+	var selectors []selector
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, pattern, ok := strings.Cut(item, ":")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid %s value %q: selectors are written key:value", option, item)
+		}
+		known := false
+		for _, k := range selectorKeys {
+			known = known || k == key
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid %s value %q: the key must be one of %s", option, item, strings.Join(selectorKeys, ", "))
+		}
+		switch key {
+		case "id":
+			pattern = normalizeUUID(pattern)
+		case "title", "path":
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid %s value %q: %w", option, item, err)
+			}
+		}
+		selectors = append(selectors, selector{key: key, value: pattern})
+	}
+	return selectors, nil
+}
+
+// match reports whether one of selectors matches a page, database or data
+// source of the tree.
+func match(selectors []selector, node *PageNode) bool {
+	for _, s := range selectors {
+		var ok bool
+		switch s.key {
+		case "id":
+			ok = node.Page.ID == s.value
+		case "title":
+			ok, _ = path.Match(s.value, node.Page.title())
+		case "path":
+			ok, _ = path.Match(s.value, titlePath(node))
+		case "type":
+			ok = objectType(node.Page) == s.value
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// excludes reports whether node is skipped with its descendants.
+func (f *filter) excludes(node *PageNode) bool {
+	return match(f.exclude, node)
+}
+
+// includes reports whether node is saved, when it isn't excluded. Its
+// ancestors are connected to the root, so they have been checked first.
+func (f *filter) includes(node *PageNode) bool {
+	if len(f.include) == 0 || match(f.include, node) {
+		return true
+	}
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Page.Object != "block" {
+			return parent.Saved
+		}
+	}
+	return false
+}
+
+// includedIDs returns the IDs named by the id selectors of include.
+func (f *filter) includedIDs() []string {
+	var ids []string
+	for _, s := range f.include {
+		if s.key == "id" {
+			ids = append(ids, s.value)
+		}
+	}
+	return ids
+}
+
+// excludesBlock returns the type of block when it is excluded, an empty
+// string otherwise.
+func (f *filter) excludesBlock(block json.RawMessage) string {
+	if f == nil {
+		return ""
+	}
+	var b struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(block, &b); err != nil {
+		return ""
+	}
+	for _, s := range f.exclude {
+		if s.key == "block" && s.value == b.Type {
+			return b.Type
+		}
+	}
+	return ""
+}
+
+// objectType returns the type of an object as written in type selectors,
+// "row" for the pages of a database.
+func objectType(pg Page) string {
+	if pg.Object == "page" && isRowParent(pg.Parent["type"]) {
+		return "row"
+	}
+	return pg.Object
+}
+
+// titlePath returns the titles of the pages and databases from the top of
+// the tree down to node, joined by "/".
+func titlePath(node *PageNode) string {
+	var titles []string
+	for n := node; n != nil; n = n.Parent {
+		if n.Page.Object != "block" {
+			titles = append([]string{n.Page.title()}, titles...)
+		}
+	}
+	return strings.Join(titles, "/")
+}
+
+// title returns the plain text title of a page, database or data source.
+func (pg Page) title() string {
+	object := map[string]any{"properties": pg.Properties}
+	if pg.Title != nil {
+		object["title"] = pg.Title
+	}
+	return titleOf(object)
+}
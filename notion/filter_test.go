@@ -0,0 +1,66 @@
+package notion
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+func TestScanFilters(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	pageDir := "/" + f.page
+
+	files := scanSnapshot(t, newTestImporter(t, m, map[string]string{"exclude": "type:database, block:image"}))
+	if _, ok := files[pageDir+"/"+f.database+"/database.json"]; ok {
+		t.Errorf("excluded database saved")
+	}
+	if _, ok := files[pageDir+"/"+f.database+"/"+f.row+"/page.json"]; ok {
+		t.Errorf("row of an excluded database saved")
+	}
+	if _, ok := files[pageDir+"/"+f.image+".jpg"]; ok {
+		t.Errorf("excluded image downloaded")
+	}
+	page := decodeFile[map[string]any](t, files, pageDir+"/page.json")
+	children, _ := page["children"].([]any)
+	for _, child := range children {
+		if block, _ := child.(map[string]any); block["type"] == "image" {
+			t.Errorf("excluded image block saved in page.json")
+		}
+	}
+	got := decodeFile[manifest](t, files, "/manifest.json")
+	if got.Excluded["database"] != 1 || got.Excluded["image"] != 1 || got.Counts.Databases != 0 {
+		t.Errorf("manifest excluded = %v, counts = %+v", got.Excluded, got.Counts)
+	}
+
+	files = scanSnapshot(t, newTestImporter(t, m, map[string]string{"exclude": "path:Spec/Child"}))
+	if _, ok := files[pageDir+"/"+f.child+"/page.json"]; ok {
+		t.Errorf("page excluded by path saved")
+	}
+	decodeFile[map[string]any](t, files, pageDir+"/page.json")
+
+	// the page above the included one is only a directory
+	files = scanSnapshot(t, newTestImporter(t, m, map[string]string{"include": "title:Ch*"}))
+	if _, ok := files[pageDir+"/page.json"]; ok {
+		t.Errorf("page outside of include saved")
+	}
+	decodeFile[map[string]any](t, files, pageDir+"/"+f.child+"/page.json")
+	if _, ok := files[pageDir+"/"+f.database+"/database.json"]; ok {
+		t.Errorf("database outside of include saved")
+	}
+
+	for _, cfg := range []map[string]string{
+		{"exclude": "Spec"},
+		{"exclude": "name:Spec"},
+		{"include": "block:image"},
+		{"include": "title:[Spec"},
+	} {
+		cfg["token"] = mockToken
+		cfg["base_url"] = m.baseURL()
+		if _, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("%v: expected an invalid option error, got %v", cfg, err)
+		}
+	}
+}
@@ -0,0 +1,502 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// snapshotChildBlocks returns a children function reading the blocks of the
+// page saved in pageDir: the page's own blocks are in its page.json, the
+// children of a block in the blocks.json of the block's directory.
+func snapshotChildBlocks(pageDir string, page map[string]any) func(rel, id string) []map[string]any {
+	return func(rel, id string) []map[string]any {
+		if rel == "" {
+			children, _ := snapshotChildren(page["children"])
+			return children
+		}
+		f, err := os.Open(path.Join(pageDir, rel, "blocks.json"))
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		var children []map[string]any
+		if err := json.NewDecoder(f).Decode(&children); err != nil {
+			return nil
+		}
+		return children
+	}
+}
+
+// htmlRenderer renders Notion blocks as HTML, see markdownRenderer.
+type htmlRenderer struct {
+	children func(rel, id string) []map[string]any
+	links    blockLinks
+}
+
+func (r *htmlRenderer) renderBlocks(sb *strings.Builder, blocks []map[string]any, rel string) {
+	for i := 0; i < len(blocks); i++ {
+		blockType, _ := blocks[i]["type"].(string)
+		list := ""
+		switch blockType {
+		case "bulleted_list_item", "to_do":
+			list = "ul"
+		case "numbered_list_item":
+			list = "ol"
+		}
+		if list == "" {
+			r.renderBlock(sb, blocks[i], rel)
+			continue
+		}
+
+		// consecutive list items are grouped in a single list
+		fmt.Fprintf(sb, "<%s>\n", list)
+		for ; i < len(blocks) && blocks[i]["type"] == blockType; i++ {
+			sb.WriteString("<li>")
+			r.renderBlock(sb, blocks[i], rel)
+			sb.WriteString("</li>\n")
+		}
+		i--
+		fmt.Fprintf(sb, "</%s>\n", list)
+	}
+}
+
+func (r *htmlRenderer) renderBlock(sb *strings.Builder, block map[string]any, rel string) {
+	blockType, _ := block["type"].(string)
+	id, _ := block["id"].(string)
+	content, _ := block[blockType].(map[string]any)
+	rt, _ := content["rich_text"].([]any)
+	text := htmlText(rt)
+	hasChildren, _ := block["has_children"].(bool)
+	childRel := rel + id + "/"
+
+	switch blockType {
+	case "paragraph":
+		fmt.Fprintf(sb, "<p>%s</p>\n", text)
+	case "heading_1", "heading_2", "heading_3":
+		// h1 is the page title
+		level := int(blockType[len(blockType)-1]-'0') + 1
+		fmt.Fprintf(sb, "<h%d>%s</h%d>\n", level, text, level)
+	case "bulleted_list_item", "numbered_list_item":
+		sb.WriteString(text)
+	case "to_do":
+		checked := ""
+		if done, _ := content["checked"].(bool); done {
+			checked = " checked"
+		}
+		fmt.Fprintf(sb, "<input type=\"checkbox\" disabled%s> %s", checked, text)
+	case "quote":
+		fmt.Fprintf(sb, "<blockquote>%s</blockquote>\n", text)
+	case "callout":
+		icon := ""
+		if emoji, ok := content["icon"].(map[string]any); ok && emoji["type"] == "emoji" {
+			icon, _ = emoji["emoji"].(string)
+			icon = html.EscapeString(icon) + " "
+		}
+		fmt.Fprintf(sb, "<aside class=\"callout\">%s%s</aside>\n", icon, text)
+	case "code":
+		language, _ := content["language"].(string)
+		fmt.Fprintf(sb, "<pre><code class=\"language-%s\">%s</code></pre>\n", html.EscapeString(language), html.EscapeString(plainText(rt)))
+	case "equation":
+		expression, _ := content["expression"].(string)
+		fmt.Fprintf(sb, "<pre class=\"equation\">%s</pre>\n", html.EscapeString(expression))
+	case "divider":
+		sb.WriteString("<hr>\n")
+	case "toggle":
+		fmt.Fprintf(sb, "<details>\n<summary>%s</summary>\n", text)
+		if hasChildren {
+			r.renderBlocks(sb, r.children(childRel, id), childRel)
+		}
+		sb.WriteString("</details>\n")
+		return
+	case "table":
+		r.renderTable(sb, r.children(childRel, id), content)
+		return
+	case "image", "file", "pdf", "video", "audio":
+		caption, _ := content["caption"].([]any)
+		label := html.EscapeString(plainText(caption))
+		if label == "" {
+			label = blockType
+		}
+		target := r.links.asset(rel, block)
+		if target == "" {
+			target = safeURL(fileURL(content))
+		}
+		if target == "" {
+			fmt.Fprintf(sb, "<p>%s</p>\n", label)
+		} else if blockType == "image" {
+			fmt.Fprintf(sb, "<figure><img src=\"%s\" alt=\"%s\"><figcaption>%s</figcaption></figure>\n", html.EscapeString(target), label, label)
+		} else {
+			fmt.Fprintf(sb, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(target), label)
+		}
+	case "bookmark", "embed", "link_preview":
+		u, _ := content["url"].(string)
+		if safeURL(u) == "" {
+			fmt.Fprintf(sb, "<p>%s</p>\n", html.EscapeString(u))
+		} else {
+			fmt.Fprintf(sb, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(u), html.EscapeString(u))
+		}
+	case "child_page":
+		title, _ := content["title"].(string)
+		fmt.Fprintf(sb, "<p class=\"page\"><a href=\"%s\">%s</a></p>\n", html.EscapeString(r.links.page(rel, id)), html.EscapeString(title))
+		return
+	case "child_database":
+		title, _ := content["title"].(string)
+		fmt.Fprintf(sb, "<p class=\"database\"><a href=\"%s\">%s</a></p>\n", html.EscapeString(r.links.database(rel, id)), html.EscapeString(title))
+		return
+	case "column_list", "column", "synced_block", "table_of_contents", "breadcrumb":
+		// layout blocks, only their children are rendered
+	default:
+		if text != "" {
+			fmt.Fprintf(sb, "<p>%s</p>\n", text)
+		}
+	}
+
+	if hasChildren {
+		sb.WriteString("<div class=\"children\">\n")
+		r.renderBlocks(sb, r.children(childRel, id), childRel)
+		sb.WriteString("</div>\n")
+	}
+}
+
+func (r *htmlRenderer) renderTable(sb *strings.Builder, rows []map[string]any, table map[string]any) {
+	header, _ := table["has_column_header"].(bool)
+	sb.WriteString("<table>\n")
+	for i, row := range rows {
+		content, _ := row["table_row"].(map[string]any)
+		cells, _ := content["cells"].([]any)
+		cell := "td"
+		if i == 0 && header {
+			cell = "th"
+		}
+		sb.WriteString("<tr>")
+		for _, c := range cells {
+			rt, _ := c.([]any)
+			fmt.Fprintf(sb, "<%s>%s</%s>", cell, htmlText(rt), cell)
+		}
+		sb.WriteString("</tr>\n")
+	}
+	sb.WriteString("</table>\n")
+}
+
+// htmlText renders a rich text array with its annotations and links.
+func htmlText(richText []any) string {
+	var sb strings.Builder
+	for _, t := range richText {
+		r, _ := t.(map[string]any)
+		text := html.EscapeString(plainText([]any{r}))
+
+		annotations, _ := r["annotations"].(map[string]any)
+		for _, a := range []struct{ annotation, tag string }{
+			{"code", "code"},
+			{"bold", "strong"},
+			{"italic", "em"},
+			{"strikethrough", "s"},
+			{"underline", "u"},
+		} {
+			if on, _ := annotations[a.annotation].(bool); on {
+				text = "<" + a.tag + ">" + text + "</" + a.tag + ">"
+			}
+		}
+		if href, _ := r["href"].(string); safeURL(href) != "" {
+			text = "<a href=\"" + html.EscapeString(href) + "\">" + text + "</a>"
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// safeURL returns u when it is an http, https or mailto URL, or a relative
+// one, and "" otherwise: a javascript: or data: link would run in the site.
+func safeURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https", "mailto":
+		return u
+	}
+	return ""
+}
+
+const htmlStyle = `body{font-family:sans-serif;max-width:50em;margin:2em auto;padding:0 1em;line-height:1.5}
+nav{font-size:.9em;color:#666}img{max-width:100%}.icon{height:1.2em}.cover{width:100%;max-height:15em;object-fit:cover}
+table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:.3em .6em;text-align:left}
+.callout{background:#f5f5f5;padding:.8em;border-radius:4px}.children{margin-left:1.5em}pre{background:#f5f5f5;padding:.8em;overflow:auto}`
+
+// snapshotIndex locates the pages and databases of a restored tree.
+type snapshotIndex struct {
+	titles map[string]string // page or database directory -> title
+	dirs   map[string]string // page or database ID -> directory
+}
+
+func indexSnapshot(root string) (*snapshotIndex, error) {
+	index := &snapshotIndex{titles: make(map[string]string), dirs: make(map[string]string)}
+	err := filepath.WalkDir(root, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if name := d.Name(); name == "page.json" || name == "database.json" {
+			object, err := loadJSONFromFile(pathname)
+			if err != nil {
+				return err
+			}
+			index.titles[path.Dir(pathname)] = titleOf(object)
+			index.dirs[path.Base(path.Dir(pathname))] = path.Dir(pathname)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+	return index, nil
+}
+
+// resolver resolves related pages to their title in the snapshot.
+func (index *snapshotIndex) resolver(userName func(id string) string) *propertyResolver {
+	return &propertyResolver{
+		user: userName,
+		page: func(id string) string {
+			if dir, ok := index.dirs[id]; ok {
+				return index.titles[dir]
+			}
+			return id
+		},
+	}
+}
+
+// site renders the restored tree as static HTML pages written to dir.
+type site struct {
+	src, dir string
+	titles   map[string]string // page or database directory -> title
+	resolver *propertyResolver
+}
+
+// exportSite writes the snapshot staged in tempDir as a browsable static
+// HTML site in n.path: an index.html per page and database, with the images
+// and files of the snapshot copied next to them.
+func (n *NotionExporter) exportSite() error {
+	roots, err := findRestoreRoots(tempDir)
+	if err != nil {
+		return err
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("nothing to export: no page, database or blocks found")
+	}
+	if err := n.loadSnapshotUsers(); err != nil {
+		return err
+	}
+
+	index, err := indexSnapshot(tempDir)
+	if err != nil {
+		return err
+	}
+	s := &site{src: tempDir, dir: n.path, titles: index.titles, resolver: index.resolver(n.userName)}
+
+	err = filepath.WalkDir(tempDir, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(tempDir, pathname)
+		if err != nil {
+			return err
+		}
+		target := path.Join(s.dir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		switch d.Name() {
+		case "page.json":
+			return s.writePage(path.Dir(pathname))
+		case "database.json":
+			return s.writeDatabase(path.Dir(pathname))
+		}
+		if strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		return copyFile(pathname, target)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write the site: %w", err)
+	}
+	return s.writeIndex(roots)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// relDir returns the directory of a snapshot directory within the site.
+func (s *site) relDir(dir string) string {
+	rel, _ := filepath.Rel(s.src, dir)
+	return filepath.ToSlash(rel)
+}
+
+// breadcrumb links the page in dir to the site index and to its ancestors.
+func (s *site) breadcrumb(dir string) string {
+	if dir == s.src {
+		return "" // the page is the site index
+	}
+	parts := strings.Split(s.relDir(dir), "/")
+	up := func(n int) string { return strings.Repeat("../", n) }
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<nav><a href=\"%sindex.html\">Index</a>", up(len(parts)))
+	for i := 0; i < len(parts)-1; i++ {
+		ancestor := path.Join(s.src, path.Join(parts[:i+1]...))
+		title, ok := s.titles[ancestor]
+		if !ok {
+			continue // block directory
+		}
+		fmt.Fprintf(&sb, " / <a href=\"%sindex.html\">%s</a>", up(len(parts)-1-i), html.EscapeString(title))
+	}
+	sb.WriteString("</nav>\n")
+	return sb.String()
+}
+
+// header renders the cover, icon and title of a page or database.
+func (s *site) header(dir string, object map[string]any) string {
+	var sb strings.Builder
+	if file, ok := findMediaFile(dir, "cover"); ok {
+		fmt.Fprintf(&sb, "<img class=\"cover\" src=\"%s\" alt=\"\">\n", html.EscapeString(path.Base(file)))
+	}
+	sb.WriteString("<h1>")
+	if file, ok := findMediaFile(dir, "icon"); ok {
+		fmt.Fprintf(&sb, "<img class=\"icon\" src=\"%s\" alt=\"\"> ", html.EscapeString(path.Base(file)))
+	} else if icon, ok := object["icon"].(map[string]any); ok && icon["type"] == "emoji" {
+		emoji, _ := icon["emoji"].(string)
+		sb.WriteString(html.EscapeString(emoji) + " ")
+	}
+	sb.WriteString(html.EscapeString(titleOf(object)))
+	sb.WriteString("</h1>\n")
+	return sb.String()
+}
+
+func (s *site) writeHTML(dir, title, body string) error {
+	pathname := path.Join(s.dir, s.relDir(dir), "index.html")
+	document := "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + html.EscapeString(title) +
+		"</title>\n<style>" + htmlStyle + "</style>\n</head>\n<body>\n" + body + "</body>\n</html>\n"
+	if err := os.WriteFile(pathname, []byte(document), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", pathname, err)
+	}
+	return nil
+}
+
+var siteLinks = snapshotLinks("index.html", "index.html")
+
+func (s *site) writePage(dir string) error {
+	page, err := loadJSONFromFile(path.Join(dir, "page.json"))
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(s.breadcrumb(dir))
+	sb.WriteString(s.header(dir, page))
+
+	// database rows show their properties above their content
+	if parent, _ := page["parent"].(map[string]any); isRowParent(parent["type"]) {
+		properties, _ := page["properties"].(map[string]any)
+		sb.WriteString("<table class=\"properties\">\n")
+		for _, name := range databaseColumns(properties) {
+			prop, _ := properties[name].(map[string]any)
+			if prop["type"] == "title" {
+				continue
+			}
+			fmt.Fprintf(&sb, "<tr><th>%s</th><td>%s</td></tr>\n", html.EscapeString(name), html.EscapeString(s.resolver.propertyText(prop)))
+		}
+		sb.WriteString("</table>\n")
+	}
+
+	id := path.Base(dir)
+	r := &htmlRenderer{children: snapshotChildBlocks(dir, page), links: siteLinks}
+	r.renderBlocks(&sb, r.children("", id), "")
+	return s.writeHTML(dir, titleOf(page), sb.String())
+}
+
+func (s *site) writeDatabase(dir string) error {
+	database, err := loadJSONFromFile(path.Join(dir, "database.json"))
+	if err != nil {
+		return err
+	}
+	schema, rows, err := snapshotRows(dir, database)
+	if err != nil {
+		return err
+	}
+	columns := databaseColumns(schema)
+
+	var sb strings.Builder
+	sb.WriteString(s.breadcrumb(dir))
+	sb.WriteString(s.header(dir, database))
+	sb.WriteString("<table>\n<tr>")
+	for _, name := range columns {
+		fmt.Fprintf(&sb, "<th>%s</th>", html.EscapeString(name))
+	}
+	sb.WriteString("</tr>\n")
+
+	for _, rel := range rows {
+		row, err := loadJSONFromFile(path.Join(dir, rel, "page.json"))
+		if err != nil {
+			continue
+		}
+		properties, _ := row["properties"].(map[string]any)
+		sb.WriteString("<tr>")
+		for _, name := range columns {
+			prop, _ := properties[name].(map[string]any)
+			text := html.EscapeString(s.resolver.propertyText(prop))
+			if prop["type"] == "title" {
+				text = fmt.Sprintf("<a href=\"%s/index.html\">%s</a>", html.EscapeString(rel), text)
+			}
+			fmt.Fprintf(&sb, "<td>%s</td>", text)
+		}
+		sb.WriteString("</tr>\n")
+	}
+	sb.WriteString("</table>\n")
+	return s.writeHTML(dir, titleOf(database), sb.String())
+}
+
+// writeIndex writes the entry point of the site, linking to the topmost
+// pages and databases, unless one of them is already written there.
+func (s *site) writeIndex(roots []restoreRoot) error {
+	for _, root := range roots {
+		if root.dir == s.src {
+			// a single page or database restored at the top is its own index
+			return nil
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return s.titles[roots[i].dir] < s.titles[roots[j].dir] })
+
+	var sb strings.Builder
+	sb.WriteString("<h1>Notion</h1>\n<ul>\n")
+	for _, root := range roots {
+		title, ok := s.titles[root.dir]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&sb, "<li><a href=\"%s/index.html\">%s</a></li>\n", html.EscapeString(s.relDir(root.dir)), html.EscapeString(title))
+	}
+	sb.WriteString("</ul>\n")
+	return s.writeHTML(s.src, "Notion", sb.String())
+}
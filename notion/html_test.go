@@ -0,0 +1,175 @@
+package notion
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/kloset/snapshot/exporter"
+)
+
+func TestExportHTMLSite(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	os.RemoveAll(tempDir)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+	dir := t.TempDir()
+	exp, err := NewNotionExporter(context.Background(), &exporter.Options{}, "notion", map[string]string{"format": "html", "path": dir})
+	if err != nil {
+		t.Fatalf("NewNotionExporter: %v", err)
+	}
+	restoreSnapshot(t, exp, files)
+
+	read := func(pathname string) string {
+		t.Helper()
+		data, err := os.ReadFile(path.Join(dir, pathname))
+		if err != nil {
+			t.Fatalf("failed to read the site: %v", err)
+		}
+		return string(data)
+	}
+
+	index := read("index.html")
+	if !strings.Contains(index, `<a href="`+f.page+`/index.html">Spec</a>`) {
+		t.Errorf("index.html does not link to Spec:\n%s", index)
+	}
+
+	page := read(f.page + "/index.html")
+	for _, want := range []string{
+		`<nav><a href="../index.html">Index</a></nav>`,
+		`<h1><img class="icon" src="icon.png" alt=""> Spec</h1>`,
+		"<p>hello</p>",
+		"<details>\n<summary>more</summary>\n<p>hidden</p>\n</details>",
+		`<img src="` + f.image + `.jpg"`,
+		`<a href="` + f.child + `/index.html">Child</a>`,
+		`<a href="` + f.database + `/index.html">Tasks</a>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page is missing %q:\n%s", want, page)
+		}
+	}
+	if got := read(f.page + "/" + f.image + ".jpg"); got != "image-bytes" {
+		t.Errorf("image content = %q", got)
+	}
+
+	database := read(f.page + "/" + f.database + "/index.html")
+	if !strings.Contains(database, `<td><a href="`+f.row+`/index.html">Task 1</a></td>`) {
+		t.Errorf("database table is missing the row:\n%s", database)
+	}
+	row := read(f.page + "/" + f.database + "/" + f.row + "/index.html")
+	if !strings.Contains(row, `<a href="../../index.html">Spec</a> / <a href="../index.html">Tasks</a>`) {
+		t.Errorf("row breadcrumb is missing its ancestors:\n%s", row)
+	}
+}
+
+func TestExportHTMLDataSourceRowProperties(t *testing.T) {
+	src := newMockNotion(t)
+	page := src.AddPage("workspace", "", "Spec")
+	database := src.AddDatabase(page, "Projects")
+	active := src.AddDataSource(database, "Active")
+	alpha := src.AddRow(active, "Alpha")
+	src.SetProperty(alpha, "Status", map[string]any{"type": "select", "select": map[string]any{"name": "Done"}})
+	files := scanSnapshot(t, newTestImporter(t, src, map[string]string{"api_version": DataSourcesVersion}))
+
+	os.RemoveAll(tempDir)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+	dir := t.TempDir()
+	exp, err := NewNotionExporter(context.Background(), &exporter.Options{}, "notion", map[string]string{"format": "html", "path": dir})
+	if err != nil {
+		t.Fatalf("NewNotionExporter: %v", err)
+	}
+	restoreSnapshot(t, exp, files)
+
+	data, err := os.ReadFile(path.Join(dir, page, database, active, alpha, "index.html"))
+	if err != nil {
+		t.Fatalf("failed to read the row: %v", err)
+	}
+	if row := string(data); !strings.Contains(row, "<tr><th>Status</th><td>Done</td></tr>") {
+		t.Errorf("row is missing its properties:\n%s", row)
+	}
+}
+
+func TestExportHTMLSinglePage(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	// a page restored on its own is staged at the top
+	prefix := "/" + f.page + "/" + f.child
+	page := make(map[string][]byte)
+	for pathname, data := range subtree(files, prefix) {
+		page[strings.TrimPrefix(pathname, prefix)] = data
+	}
+
+	os.RemoveAll(tempDir)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+	dir := t.TempDir()
+	exp, err := NewNotionExporter(context.Background(), &exporter.Options{}, "notion", map[string]string{"format": "html", "path": dir})
+	if err != nil {
+		t.Fatalf("NewNotionExporter: %v", err)
+	}
+	restoreSnapshot(t, exp, page)
+
+	data, err := os.ReadFile(path.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatalf("failed to read the site: %v", err)
+	}
+	index := string(data)
+	if !strings.Contains(index, "<p>child text</p>") {
+		t.Errorf("index.html is not the restored page:\n%s", index)
+	}
+	if strings.Contains(index, "../index.html") {
+		t.Errorf("index.html links outside the site:\n%s", index)
+	}
+}
+
+func TestExportHTMLUnsafeLinks(t *testing.T) {
+	src := newMockNotion(t)
+	page := src.AddPage("workspace", "", "Links")
+	link := func(text, href string) map[string]any {
+		rt := richText(text)
+		rt[0].(map[string]any)["href"] = href
+		return map[string]any{"rich_text": rt}
+	}
+	src.AddBlock(page, "paragraph", link("site", "https://example.com"))
+	src.AddBlock(page, "paragraph", link("mail", "mailto:ada@example.com"))
+	src.AddBlock(page, "paragraph", link("other page", "/0000000000004000800000000000000a"))
+	src.AddBlock(page, "paragraph", link("click", "javascript:alert(1)"))
+	src.AddBlock(page, "bookmark", map[string]any{"url": "JavaScript:alert(2)"})
+	src.AddBlock(page, "embed", map[string]any{"url": "data:text/html,<script>alert(3)</script>"})
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	os.RemoveAll(tempDir)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+	dir := t.TempDir()
+	exp, err := NewNotionExporter(context.Background(), &exporter.Options{}, "notion", map[string]string{"format": "html", "path": dir})
+	if err != nil {
+		t.Fatalf("NewNotionExporter: %v", err)
+	}
+	restoreSnapshot(t, exp, files)
+
+	data, err := os.ReadFile(path.Join(dir, page, "index.html"))
+	if err != nil {
+		t.Fatalf("failed to read the page: %v", err)
+	}
+	html := string(data)
+	for _, want := range []string{
+		`<a href="https://example.com">site</a>`,
+		`<a href="mailto:ada@example.com">mail</a>`,
+		`<a href="/0000000000004000800000000000000a">other page</a>`,
+		"<p>click</p>",
+		"<p>JavaScript:alert(2)</p>",
+		"<p>data:text/html,&lt;script&gt;alert(3)&lt;/script&gt;</p>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page is missing %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(strings.ToLower(html), `href="javascript:`) || strings.Contains(html, `href="data:`) {
+		t.Errorf("page links to a script:\n%s", html)
+	}
+}
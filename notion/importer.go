@@ -6,11 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PlakarKorp/kloset/objects"
@@ -18,32 +20,181 @@ import (
 )
 
 type NotionImporter struct {
-	token  string
-	rootID string // TODO: take a look at this
+	client   *client
+	bot      *Bot   // integration of the token, from /users/me
+	rootID   string // TODO: take a look at this
+	scope    string // page or database backed up with its descendants, empty for the whole workspace
+	comments string // one of CommentsAll, CommentsPages or CommentsNone
+	markdown bool
+	csv      bool
+	users    bool // users.json is saved, the integration can list the users
+
+	// blocks read so far, by page or block ID, to render the page.md files
+	blocks   map[string][]json.RawMessage
+	stats    *scanStats
+	progress *progress
+	filter   *filter       // include and exclude options
+	archive  *archiveQueue // IDs to check for pages in the trash, nil without include_archived
+	workers  int           // block lists fetched in parallel, see the workers option
+	orphans  string        // one of OrphansTop, OrphansDirectory or OrphansSkip
+	prefetch *prefetcher   // started by Scan, nil with no workers
+
+	// IDs of the blocks read so far with comments=all, by page or block
+	// ID, and the comments.json of the blocks with children, saved once
+	// every block is read
+	blockIDs     map[string][]string
+	commentPaths []string
+
+	orphansChecked bool      // the pages waiting for a parent were handled
+	orphanDir      *PageNode // directory of the orphans with OrphansDirectory
+
+	tree      *pageTree
+	databases sync.Mutex // held while adding the database of a data source
 
 	notionChan chan notionRecord
 	done       chan struct{}
-	nReader    int
+	nReader    atomic.Int64 // readers that can still send records to notionChan
+	pending    atomic.Int64 // files emitted whose reader isn't closed yet, see fileRecord
+
+	usersOnce sync.Once // the users are listed once per scan, see workspaceUsers
+	userList  []json.RawMessage
+	userNames map[string]string // user names by ID
+	userErr   error
 }
 
 func NewNotionImporter(ctx context.Context, options *importer.Options, name string, config map[string]string) (importer.Importer, error) {
-	token, ok := config["token"]
-	if !ok {
-		return nil, fmt.Errorf("missing token in config")
+	if err := setLogLevel(config); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(config["location"], ZipScheme) {
+		return newZipImporter(config["location"])
+	}
+
+	comments := CommentsPages
+	if value, ok := config["comments"]; ok {
+		switch value {
+		case CommentsAll, CommentsPages, CommentsNone:
+			comments = value
+		default:
+			return nil, fmt.Errorf("invalid comments value %q: must be %q, %q or %q", value, CommentsAll, CommentsPages, CommentsNone)
+		}
+	}
+
+	var err error
+	markdown := false
+	if value, ok := config["markdown"]; ok {
+		markdown, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid markdown value %q: %w", value, err)
+		}
+	}
+
+	csv := false
+	if value, ok := config["csv"]; ok {
+		csv, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv value %q: %w", value, err)
+		}
+	}
+
+	orphans := OrphansTop
+	if value, ok := config["orphans"]; ok {
+		switch value {
+		case OrphansTop, OrphansDirectory, OrphansSkip:
+			orphans = value
+		default:
+			return nil, fmt.Errorf("invalid orphans value %q: must be %q, %q or %q", value, OrphansTop, OrphansDirectory, OrphansSkip)
+		}
+	}
+
+	scope := ""
+	if rootID, ok := config["rootID"]; ok {
+		scope = normalizeUUID(rootID)
+	}
+
+	var archive *archiveQueue
+	if value, ok := config["include_archived"]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include_archived value %q: %w", value, err)
+		}
+		if enabled {
+			archive = newArchiveQueue()
+		}
+	}
+
+	workers := DefaultWorkers
+	if value, ok := config["workers"]; ok {
+		workers, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid workers value %q: %w", value, err)
+		}
+		if workers < 0 {
+			return nil, fmt.Errorf("invalid workers value %q: must not be negative", value)
+		}
+	}
+
+	filter, err := newFilter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	progress, err := newProgress(ctx, config, "backup", "fetched")
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("versionning, v42")
+	// every option is valid, the token is checked before anything else is
+	// asked to the API
+	client, err := newClientFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	bot, err := fetchBot(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token: %w", err)
+	}
+	client.progress = progress
 
-	return &NotionImporter{
-		token:      token,
+	p := &NotionImporter{
+		client:     client,
+		bot:        bot,
 		rootID:     "/",
+		scope:      scope,
+		comments:   comments,
+		markdown:   markdown,
+		csv:        csv,
+		blocks:     make(map[string][]json.RawMessage),
+		blockIDs:   make(map[string][]string),
+		stats:      newScanStats(),
+		progress:   progress,
+		filter:     filter,
+		archive:    archive,
+		workers:    workers,
+		orphans:    orphans,
+		tree:       newPageTree(),
 		notionChan: make(chan notionRecord, 1000),
 		done:       make(chan struct{}, 1),
-	}, nil
+	}
+	if err := p.checkAccess(); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult, error) {
+	if err := p.client.metrics.serve(); err != nil {
+		return nil, err
+	}
 	results := make(chan *importer.ScanResult, 1000)
+	p.stats.started = time.Now()
+	p.progress.start()
+	p.prefetch = newPrefetcher(p.client, p.workers)
+	// the search leaves out the pages in the trash, the root of the backup
+	// and the pages named by include are checked by ID
+	p.archive.push(p.scope)
+	p.archive.push(p.filter.includedIDs()...)
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -62,12 +213,18 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 		)
 
 		results <- importer.NewScanRecord("/", "", fInfo, nil, nil)
+		if p.users {
+			results <- p.fileRecord("/users.json", objects.NewFileInfo("users.json", 0, 0700, time.Time{}, 0, 0, 0, 0, 0))
+		}
 
-		err := p.fetchAllPages("", results, &wg)
+		var search sync.WaitGroup
+		err := p.fetchAllPages("", results, &search)
+		search.Wait()
 		if err != nil {
-			results <- importer.NewScanError("", err) // TODO: handle error more gracefully
+			p.scanError(results, "", err) // TODO: handle error more gracefully
 			return
 		}
+		p.addQueriedRows(results)
 	}()
 
 	// WIP:
@@ -98,7 +255,10 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 		for {
 			if len(p.done) == 1 {
 				// all scan are done, check if there are any readers left
-				if p.nReader == 0 && len(results) == 0 && len(p.notionChan) == 0 {
+				if p.nReader.Load() == 0 && len(results) == 0 && len(p.notionChan) == 0 && p.archive.empty() {
+					if p.adoptOrphans(results) {
+						continue
+					}
 					return
 				}
 			}
@@ -108,14 +268,27 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 			case record = <-p.notionChan:
 				// process the record
 				if record.EOF == true {
-					p.nReader--
+					p.nReader.Add(-1)
 					continue
 				}
 			default:
-				// no record available, continue
+				// no record available, check the pages found in the trash
+				// once the search has built the tree of the live pages
+				if len(p.done) == 1 {
+					p.addArchived(results)
+				}
 				continue
 			}
 
+			if p.archive != nil {
+				p.archive.push(referencedIDs(record.Block)...)
+			}
+
+			if p.markdown {
+				container := path.Base(record.pathTo)
+				p.blocks[container] = append(p.blocks[container], record.Block)
+			}
+
 			// do something with the record
 			type block struct {
 				ID          string            `json:"id"`
@@ -125,9 +298,19 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 			}
 			var b block
 			if err := json.Unmarshal(record.Block, &b); err != nil {
-				results <- importer.NewScanError("", err)
+				p.scanError(results, record.pathTo, err)
 				continue
 			}
+			p.stats.block()
+			p.progress.complete(kindBlock, 1)
+			// child pages and databases have their own comments.json
+			if p.comments == CommentsAll && b.Type != "child_page" && b.Type != "child_database" {
+				container := path.Base(record.pathTo)
+				p.blockIDs[container] = append(p.blockIDs[container], b.ID)
+			}
+			if b.Type == "unsupported" {
+				p.stats.unsupportedBlock(unsupportedType(record.Block))
+			}
 
 			if b.Type == "image" {
 				type imageBlock struct {
@@ -140,19 +323,26 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 
 				var ib imageBlock
 				if err := json.Unmarshal(record.Block, &ib); err != nil {
-					results <- importer.NewScanError("", err)
+					p.scanError(results, record.pathTo, err)
 					continue
 				}
 
 				imageURL := ib.Image.File.URL
-				resp, err := http.Get(imageURL) // imageURL from Notion's response
+				if imageURL == "" {
+					// external images are only saved as links
+					p.stats.skip("image (external)")
+					continue
+				}
+				pathname := record.pathTo + "/" + b.ID + ".jpg"
+				resp, err := p.client.fetchFile(imageURL) // imageURL from Notion's response
 				if err != nil {
-					results <- importer.NewScanError("", fmt.Errorf("failed to fetch image: %w", err))
+					p.scanError(results, pathname, fmt.Errorf("failed to fetch image: %w", err))
 					continue
 				}
 
 				if resp.StatusCode != http.StatusOK {
-					results <- importer.NewScanError("", fmt.Errorf("failed to fetch image, status code: %d", resp.StatusCode))
+					resp.Body.Close()
+					p.scanError(results, pathname, fmt.Errorf("failed to fetch image, status code: %d", resp.StatusCode))
 					continue
 				}
 
@@ -168,10 +358,11 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 					0,
 				)
 
-				pathname := record.pathTo + "/" + b.ID + ".jpg"
 				results <- importer.NewScanRecord(pathname, "", fInfo, nil, func() (io.ReadCloser, error) {
 					return resp.Body, nil
 				})
+				p.stats.file()
+				p.progress.complete(kindFile, 1)
 
 			} else if b.HasChildren && b.Type != "child_page" {
 				fInfo := objects.NewFileInfo(
@@ -186,13 +377,16 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 					0,
 				)
 				pathname := record.pathTo + "/" + b.ID + "/blocks.json"
+				p.prefetch.push(b.ID)
 				results <- importer.NewScanRecord(path.Dir(pathname), "", fInfo, nil, nil)
 				fInfo.Lmode = 0700
 				fInfo.Lname = path.Base(pathname)
-				results <- importer.NewScanRecord(pathname, "", fInfo, nil, func() (io.ReadCloser, error) {
-					return p.NewReader(pathname)
-				})
-				p.nReader++
+				results <- p.fileRecord(pathname, fInfo)
+				p.nReader.Add(1)
+
+				if p.comments == CommentsAll {
+					p.commentPaths = append(p.commentPaths, path.Dir(pathname)+"/comments.json")
+				}
 
 				p.AddPagesToTree([]Page{{
 					ID:     b.ID,
@@ -201,7 +395,7 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 						"type":           b.Parent["type"],
 						b.Parent["type"]: b.Parent[b.Parent["type"]],
 					},
-				}}, results, &(p.nReader))
+				}}, results)
 			}
 		}
 	}()
@@ -209,6 +403,32 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 	go func() {
 		wg2.Wait()
 
+		// every block and row has been read, pages can be rendered,
+		// databases flattened and the discussions of the blocks listed
+		commentPaths := p.commentPaths
+		for _, entry := range p.tree.saved() {
+			if entry.page.Object == "page" && p.comments != CommentsNone {
+				commentPaths = append(commentPaths, entry.path+"/comments.json")
+			}
+			var name string
+			if entry.page.Object == "page" && p.markdown {
+				name = "page.md"
+			} else if (entry.page.Object == "database" || entry.page.Object == "data_source") && entry.page.Properties != nil && p.csv {
+				name = "rows.csv"
+			} else {
+				continue
+			}
+			pathname := entry.path + "/" + name
+			results <- p.fileRecord(pathname, objects.NewFileInfo(name, 0, 0700, time.Time{}, 0, 0, 0, 0, 0))
+		}
+		for _, pathname := range commentPaths {
+			results <- p.fileRecord(pathname, objects.NewFileInfo("comments.json", 0, 0700, time.Time{}, 0, 0, 0, 0, 0))
+		}
+
+		results <- importer.NewScanRecord("/manifest.json", "", objects.NewFileInfo("manifest.json", 0, 0700, time.Time{}, 0, 0, 0, 0, 0), nil, func() (io.ReadCloser, error) {
+			return p.NewReader("/manifest.json")
+		})
+
 		fInfo := objects.NewFileInfo(
 			"content.json",
 			0,
@@ -224,24 +444,118 @@ func (p *NotionImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult,
 			return p.NewReader("/content.json")
 		})
 
+		p.prefetch.close()
+		p.progress.finish()
 		close(results)
 	}()
 	return results, nil
 }
 
+// skipBlock reports whether a block is left out of the backup by the
+// exclude option, with its content.
+func (p *NotionImporter) skipBlock(block json.RawMessage) bool {
+	blockType := p.filter.excludesBlock(block)
+	if blockType == "" {
+		return false
+	}
+	p.stats.exclude(blockType)
+	return true
+}
+
+// fileRecord returns the scan record of a file read by NewReader. The file
+// is pending until its reader is closed or fails, and the manifest waits
+// for every pending file so that their failures are listed in it.
+func (p *NotionImporter) fileRecord(pathname string, fileinfo objects.FileInfo) *importer.ScanResult {
+	p.pending.Add(1)
+	return importer.NewScanRecord(pathname, "", fileinfo, nil, func() (io.ReadCloser, error) {
+		rd, err := p.NewReader(pathname)
+		if err != nil {
+			p.pending.Add(-1)
+			return nil, err
+		}
+		return &pendingReader{ReadCloser: rd, p: p, pathname: pathname}, nil
+	})
+}
+
+// pendingReader is the reader of a pending file. A failure while reading
+// it is recorded in the manifest.
+type pendingReader struct {
+	io.ReadCloser
+	p        *NotionImporter
+	pathname string
+	failed   bool
+	closed   bool
+}
+
+func (r *pendingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if err != nil && err != io.EOF && !r.failed {
+		r.failed = true
+		r.p.stats.fail(r.pathname, err)
+	}
+	return n, err
+}
+
+func (r *pendingReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.p.pending.Add(-1)
+	}
+	return r.ReadCloser.Close()
+}
+
 func (p *NotionImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	rd, err := p.newReader(pathname)
+	if err != nil {
+		p.stats.fail(pathname, err)
+		return rd, err
+	}
+	name := path.Base(pathname)
+	switch name {
+	case "page.json", "database.json", "data_source.json":
+		p.progress.complete(strings.TrimSuffix(name, ".json"), 1)
+	}
+	if _, ok := isMediaFile(name); ok {
+		p.progress.complete(kindFile, 1)
+	}
+	return rd, err
+}
+
+func (p *NotionImporter) newReader(pathname string) (io.ReadCloser, error) {
 	id := path.Base(path.Dir(pathname))
 	name := path.Base(pathname)
 	var rd io.Reader
 	var err error
 
+	if key, ok := isMediaFile(name); ok {
+		return p.newMediaReader(id, key)
+	}
+
 	if name == "page.json" {
-		rd, err = NewNotionReaderFile(p.token, id, path.Dir(pathname), p.notionChan)
+		rd, err = NewNotionReaderFile(p.client, id, path.Dir(pathname), p.notionChan, p.skipBlock, p.prefetch)
 	} else if name == "blocks.json" {
-		rd, err = NewNotionReaderBlocks(p.token, id, path.Dir(pathname), p.notionChan)
+		rd, err = NewNotionReaderBlocks(p.client, id, path.Dir(pathname), p.notionChan, p.skipBlock, p.prefetch)
+	} else if name == "page.md" {
+		rd, err = p.newMarkdownReader(id)
+	} else if name == "rows.csv" {
+		rd, err = p.newCSVReader(id)
+	} else if name == "users.json" {
+		rd, err = p.newUsersReader()
+	} else if name == "comments.json" {
+		page, ok := p.tree.page(id)
+		rd, err = p.newCommentsReader(id, !ok || page.Object != "block")
 	} else if name == "database.json" {
-		rd, err = NewNotionReaderDatabase(p.token, id)
-		p.nReader-- // This counter is used to track the number of readers that can produce records, databases can't.
+		rd, err = NewNotionReaderDatabase(p.client, id)
+		p.nReader.Add(-1) // This counter is used to track the number of readers that can produce records, databases can't.
+	} else if name == "data_source.json" {
+		rd, err = NewNotionReaderDataSource(p.client, id)
+		p.nReader.Add(-1)
+	} else if name == "manifest.json" {
+		// the other files are read first, their failures are listed
+		for p.pending.Load() > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		rd, err = p.newManifestReader()
 	} else if name == "content.json" {
 		for {
 			if len(p.done) == 1 {
@@ -252,6 +566,7 @@ func (p *NotionImporter) NewReader(pathname string) (io.ReadCloser, error) {
 		buff := make([]byte, 0)
 		buff = append(buff, []byte("[")...)
 		i := 0
+		topLevelPages := p.tree.topLevelPages()
 		for id, typ := range topLevelPages {
 			buff = append(buff, []byte("{\"parent\":{\"page_id\":\""+p.rootID+"\"},\"id\":\""+id+"\",\"object\":\""+typ+"\"}")...)
 			if i == len(topLevelPages)-1 {
@@ -281,15 +596,26 @@ func (p *NotionImporter) GetExtendedAttributes(pathname string) ([]importer.Exte
 }
 
 func (p *NotionImporter) Close(ctx context.Context) error {
-	ClearNodeTree()
+	p.prefetch.close()
+	p.client.close()
 	return nil
 }
 
+// Root returns the scope of the backup, the path of the page or database
+// given by rootID or "/" for the whole workspace.
 func (p *NotionImporter) Root(ctx context.Context) (string, error) {
+	if p.scope != "" {
+		return "/" + p.scope, nil
+	}
 	return p.rootID, nil
 }
 
+// Origin returns the workspace of the token, so that the snapshots of
+// different workspaces can be told apart.
 func (p *NotionImporter) Origin(ctx context.Context) (string, error) {
+	if workspace := p.bot.workspace(); workspace != "" {
+		return workspace, nil
+	}
 	return "notion.so", nil
 }
 
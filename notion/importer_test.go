@@ -0,0 +1,272 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+// fixture is a small workspace covering the objects the connectors know
+// about: nested pages, a database with a row, a toggle with children, an
+// image, a hosted icon and comments.
+type fixture struct {
+	page, child, database, row string
+	paragraph, toggle, image   string
+}
+
+func newFixture(m *mockNotion) fixture {
+	var f fixture
+	f.page = m.AddPage("workspace", "", "Spec")
+	m.SetIcon(f.page, map[string]any{
+		"type": "file",
+		"file": map[string]any{"url": m.AddFile("icon.png", []byte("icon-bytes")), "expiry_time": "2025-01-01T01:00:00.000Z"},
+	})
+	f.paragraph = m.AddParagraph(f.page, "hello")
+	f.toggle = m.AddBlock(f.page, "toggle", map[string]any{"rich_text": richText("more")})
+	m.AddParagraph(f.toggle, "hidden")
+	f.image = m.AddBlock(f.page, "image", map[string]any{
+		"type": "file",
+		"file": map[string]any{"url": m.AddFile("diagram.png", []byte("image-bytes"))},
+	})
+	f.child = m.AddPage("page_id", f.page, "Child")
+	m.AddParagraph(f.child, "child text")
+	f.database = m.AddDatabase(f.page, "Tasks")
+	f.row = m.AddRow(f.database, "Task 1")
+
+	m.AddComment(f.page, "looks good")
+	m.AddComment(f.paragraph, "typo here")
+	m.AddUser("user-1", "Ada", "ada@example.com")
+	return f
+}
+
+// scanSnapshot runs a backup and returns the content of every file, keyed by
+// path, the way plakar would read it.
+func scanSnapshot(t *testing.T, imp importer.Importer) map[string][]byte {
+	t.Helper()
+	files, failed := scanSnapshotFailures(t, imp)
+	for pathname, err := range failed {
+		t.Fatalf("failed to read %s: %v", pathname, err)
+	}
+	return files
+}
+
+// scanSnapshotFailures runs a backup and returns the content of every file
+// that could be read, and the error of those that couldn't.
+func scanSnapshotFailures(t *testing.T, imp importer.Importer) (map[string][]byte, map[string]error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results, err := imp.Scan(ctx)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	failed := make(map[string]error)
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("scan did not complete: %v", ctx.Err())
+		case result, ok := <-results:
+			if !ok {
+				if err := imp.Close(ctx); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				return files, failed
+			}
+			if result.Error != nil {
+				t.Fatalf("scan error on %s: %v", result.Error.Pathname, result.Error.Err)
+			}
+			record := result.Record
+			if record.FileInfo.Mode().IsDir() {
+				continue
+			}
+			data, err := io.ReadAll(record.Reader)
+			record.Close()
+			if err != nil {
+				failed[record.Pathname] = err
+				continue
+			}
+			files[record.Pathname] = data
+		}
+	}
+}
+
+func newTestImporter(t *testing.T, m *mockNotion, config map[string]string) importer.Importer {
+	t.Helper()
+	cfg := map[string]string{"token": mockToken, "base_url": m.baseURL(), "rate_limit": "0"}
+	for k, v := range config {
+		cfg[k] = v
+	}
+	imp, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg)
+	if err != nil {
+		t.Fatalf("NewNotionImporter: %v", err)
+	}
+	return imp
+}
+
+func decodeFile[T any](t *testing.T, files map[string][]byte, pathname string) T {
+	t.Helper()
+	var v T
+	data, ok := files[pathname]
+	if !ok {
+		t.Fatalf("%s missing from the snapshot", pathname)
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("failed to decode %s: %v", pathname, err)
+	}
+	return v
+}
+
+func TestScanBacksUpWorkspace(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+
+	files := scanSnapshot(t, newTestImporter(t, m, nil))
+
+	for _, pathname := range []string{
+		"/content.json",
+		"/users.json",
+		"/" + f.page + "/page.json",
+		"/" + f.page + "/icon.png",
+		"/" + f.page + "/comments.json",
+		"/" + f.page + "/" + f.image + ".jpg",
+		"/" + f.page + "/" + f.toggle + "/blocks.json",
+		"/" + f.page + "/" + f.child + "/page.json",
+		"/" + f.page + "/" + f.database + "/database.json",
+		"/" + f.page + "/" + f.database + "/" + f.row + "/page.json",
+	} {
+		if _, ok := files[pathname]; !ok {
+			t.Errorf("%s missing from the snapshot", pathname)
+		}
+	}
+
+	page := decodeFile[map[string]any](t, files, "/"+f.page+"/page.json")
+	children, _ := page["children"].([]any)
+	if len(children) != 5 {
+		t.Errorf("page.json has %d children, want 5", len(children))
+	}
+
+	toggle := decodeFile[[]map[string]any](t, files, "/"+f.page+"/"+f.toggle+"/blocks.json")
+	if len(toggle) != 1 || toggle[0]["type"] != "paragraph" {
+		t.Errorf("unexpected toggle children: %v", toggle)
+	}
+
+	content := decodeFile[[]map[string]any](t, files, "/content.json")
+	if len(content) != 1 || content[0]["id"] != f.page {
+		t.Errorf("unexpected content.json: %v", content)
+	}
+
+	comments := decodeFile[[]map[string]any](t, files, "/"+f.page+"/comments.json")
+	if len(comments) != 1 {
+		t.Errorf("comments.json has %d comments, want the page-level one", len(comments))
+	}
+
+	// the blocks with comments are those read for page.json
+	files = scanSnapshot(t, newTestImporter(t, m, map[string]string{"comments": CommentsAll}))
+	comments = decodeFile[[]map[string]any](t, files, "/"+f.page+"/comments.json")
+	if len(comments) != 2 {
+		t.Errorf("comments.json has %d comments with comments=all, want 2", len(comments))
+	}
+	if n := m.Lists(f.page); n != 2 {
+		t.Errorf("children of the page listed %d times in 2 backups, want 2", n)
+	}
+
+	if got := string(files["/"+f.page+"/"+f.image+".jpg"]); got != "image-bytes" {
+		t.Errorf("image content = %q", got)
+	}
+	if got := string(files["/"+f.page+"/icon.png"]); got != "icon-bytes" {
+		t.Errorf("icon content = %q", got)
+	}
+}
+
+func TestScanRetriesRateLimitedRequests(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	m.throttle = 3
+
+	files := scanSnapshot(t, newTestImporter(t, m, map[string]string{"comments": CommentsNone}))
+
+	if _, ok := files["/"+f.page+"/"+f.database+"/"+f.row+"/page.json"]; !ok {
+		t.Fatalf("row missing from a rate-limited backup")
+	}
+	if _, ok := files["/"+f.page+"/comments.json"]; ok {
+		t.Errorf("comments.json saved with comments=none")
+	}
+}
+
+func TestNewNotionImporterRequiresToken(t *testing.T) {
+	_, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "token") {
+		t.Fatalf("expected a missing token error, got %v", err)
+	}
+}
+
+func TestNewNotionImporterValidatesToken(t *testing.T) {
+	m := newMockNotion(t)
+	_, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", map[string]string{"token": "ntn_invalid", "base_url": m.baseURL()})
+	if err == nil || !strings.Contains(err.Error(), "failed to validate token") {
+		t.Fatalf("expected an invalid token error, got %v", err)
+	}
+}
+
+func TestNewNotionImporterValidatesOptionsFirst(t *testing.T) {
+	m := newMockNotion(t)
+	for _, option := range [][2]string{
+		{"comments", "some"},
+		{"orphans", "adopt"},
+		{"include", "name:Spec"},
+		{"exclude", "title:[Spec"},
+		{"workers", "-1"},
+		{"include_archived", "maybe"},
+		{"progress_interval", "often"},
+	} {
+		cfg := map[string]string{"token": mockToken, "base_url": m.baseURL(), option[0]: option[1]}
+		if _, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("%s=%s: expected an invalid option error, got %v", option[0], option[1], err)
+		}
+	}
+	if n := m.requestCount(); n != 0 {
+		t.Errorf("invalid options made %d requests", n)
+	}
+}
+
+func TestScanRootScope(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	m.AddParagraph(m.AddPage("page_id", f.child, "Grandchild"), "deep")
+
+	imp := newTestImporter(t, m, map[string]string{"rootID": strings.ReplaceAll(f.child, "-", "")})
+	ctx := context.Background()
+	if root, _ := imp.Root(ctx); root != "/"+f.child {
+		t.Errorf("Root = %q", root)
+	}
+	if origin, _ := imp.Origin(ctx); origin != "Acme" {
+		t.Errorf("Origin = %q", origin)
+	}
+
+	files := scanSnapshot(t, imp)
+	var pages int
+	for pathname := range files {
+		if strings.HasSuffix(pathname, "/page.json") {
+			pages++
+			if !strings.HasPrefix(pathname, "/"+f.child+"/") {
+				t.Errorf("%s is outside of the scope", pathname)
+			}
+		}
+	}
+	if pages != 2 {
+		t.Errorf("saved %d pages, want the child and its subpage", pages)
+	}
+	content := decodeFile[[]map[string]any](t, files, "/content.json")
+	if len(content) != 1 || content[0]["id"] != f.child {
+		t.Errorf("content.json = %v", content)
+	}
+}
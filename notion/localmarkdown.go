@@ -0,0 +1,242 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// markdownTree writes a restored tree as Markdown files and CSV tables,
+// laid out like Notion's own "Markdown & CSV" export: a page is written to
+// "<title> <id>.md" and its subpages and files to the "<title> <id>"
+// directory next to it, a database to "<title> <id>.csv" and its rows to
+// the directory of the same name.
+type markdownTree struct {
+	src, dir string
+	index    *snapshotIndex
+	resolver *propertyResolver
+	local    map[string]string // page or database directory -> local path, without extension
+}
+
+// exportMarkdown writes the snapshot staged in tempDir to n.path.
+func (n *NotionExporter) exportMarkdown() error {
+	if err := n.loadSnapshotUsers(); err != nil {
+		return err
+	}
+	index, err := indexSnapshot(tempDir)
+	if err != nil {
+		return err
+	}
+	if len(index.titles) == 0 {
+		return fmt.Errorf("nothing to export: no page or database found")
+	}
+
+	t := &markdownTree{
+		src:      tempDir,
+		dir:      n.path,
+		index:    index,
+		resolver: index.resolver(n.userName),
+		local:    make(map[string]string),
+	}
+	for dir := range index.titles {
+		t.localPath(dir)
+	}
+
+	err = filepath.WalkDir(tempDir, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch d.Name() {
+		case "page.json":
+			return t.writePage(path.Dir(pathname))
+		case "database.json":
+			return t.writeDatabase(path.Dir(pathname))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write Markdown: %w", err)
+	}
+	return nil
+}
+
+// localName returns the name of a page or database in the export, the
+// title followed by the ID without dashes, as Notion does.
+func localName(title, id string) string {
+	title = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return ' '
+		}
+		return r
+	}, title)
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "Untitled"
+	}
+	return title + " " + strings.ReplaceAll(id, "-", "")
+}
+
+// localPath returns the local path of the page or database in dir, nested
+// in the directory of the closest page or database above it.
+func (t *markdownTree) localPath(dir string) string {
+	if local, ok := t.local[dir]; ok {
+		return local
+	}
+	local := localName(t.index.titles[dir], path.Base(dir))
+	for parent := path.Dir(dir); parent != t.src && parent != "/" && parent != "."; parent = path.Dir(parent) {
+		if _, ok := t.index.titles[parent]; ok {
+			local = t.localPath(parent) + "/" + local
+			break
+		}
+	}
+	t.local[dir] = local
+	return local
+}
+
+// relLink returns the link from the file at local path from to the one at
+// to, escaped for Markdown.
+func relLink(from, to string) string {
+	rel, err := filepath.Rel(path.Dir(from), to)
+	if err != nil {
+		rel = to
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func (t *markdownTree) writeFile(local string, data []byte) error {
+	pathname := path.Join(t.dir, local)
+	if err := os.MkdirAll(path.Dir(pathname), 0700); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", path.Dir(pathname), err)
+	}
+	if err := os.WriteFile(pathname, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", pathname, err)
+	}
+	return nil
+}
+
+// copyAsset copies a file of the snapshot to the directory of the page at
+// local, and returns the link to it from the page.
+func (t *markdownTree) copyAsset(local, src string) (string, error) {
+	dst := local + "/" + path.Base(src)
+	if err := os.MkdirAll(path.Join(t.dir, local), 0700); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", local, err)
+	}
+	if err := copyFile(src, path.Join(t.dir, dst)); err != nil {
+		return "", fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return relLink(local, dst), nil
+}
+
+// objectLink links the page at local to the page or database id, or to
+// Notion when it isn't part of the restored tree.
+func (t *markdownTree) objectLink(local, id, ext string) string {
+	if dir, ok := t.index.dirs[id]; ok {
+		return relLink(local, t.local[dir]+ext)
+	}
+	return "https://www.notion.so/" + strings.ReplaceAll(id, "-", "")
+}
+
+func yamlString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func (t *markdownTree) writePage(dir string) error {
+	page, err := loadJSONFromFile(path.Join(dir, "page.json"))
+	if err != nil {
+		return err
+	}
+	local := t.local[dir]
+
+	var copyErr error
+	links := blockLinks{
+		asset: func(rel string, block map[string]any) string {
+			id, _ := block["id"].(string)
+			src := path.Join(dir, rel, id+".jpg")
+			if _, err := os.Stat(src); err != nil {
+				return ""
+			}
+			link, err := t.copyAsset(local, src)
+			if err != nil {
+				copyErr = err
+			}
+			return link
+		},
+		page: func(rel, id string) string {
+			return t.objectLink(local, id, ".md")
+		},
+		database: func(rel, id string) string {
+			return t.objectLink(local, id, ".csv")
+		},
+	}
+
+	// properties are kept in the front matter
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	fmt.Fprintf(&sb, "title: %s\n", yamlString(titleOf(page)))
+	fmt.Fprintf(&sb, "id: %s\n", yamlString(path.Base(dir)))
+	for _, key := range mediaKeys {
+		if file, ok := findMediaFile(dir, key); ok {
+			link, err := t.copyAsset(local, file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", key, yamlString(link))
+		} else if icon, ok := page[key].(map[string]any); ok && icon["type"] == "emoji" {
+			emoji, _ := icon["emoji"].(string)
+			fmt.Fprintf(&sb, "%s: %s\n", key, yamlString(emoji))
+		}
+	}
+	properties, _ := page["properties"].(map[string]any)
+	for _, name := range databaseColumns(properties) {
+		prop, _ := properties[name].(map[string]any)
+		if prop["type"] == "title" {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", yamlString(name), yamlString(t.resolver.propertyText(prop)))
+	}
+	sb.WriteString("---\n\n")
+
+	r := &markdownRenderer{children: snapshotChildBlocks(dir, page), links: links}
+	sb.WriteString(r.renderPage(titleOf(page), path.Base(dir)))
+	if copyErr != nil {
+		return copyErr
+	}
+	return t.writeFile(local+".md", []byte(sb.String()))
+}
+
+func (t *markdownTree) writeDatabase(dir string) error {
+	database, err := loadJSONFromFile(path.Join(dir, "database.json"))
+	if err != nil {
+		return err
+	}
+	schema, dirs, err := snapshotRows(dir, database)
+	if err != nil {
+		return err
+	}
+
+	var rows []map[string]any
+	for _, rel := range dirs {
+		row, err := loadJSONFromFile(path.Join(dir, rel, "page.json"))
+		if err != nil {
+			continue
+		}
+		properties, _ := row["properties"].(map[string]any)
+		rows = append(rows, properties)
+	}
+
+	var sb strings.Builder
+	if err := writeCSV(&sb, schema, rows, t.resolver); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return t.writeFile(t.local[dir]+".csv", []byte(sb.String()))
+}
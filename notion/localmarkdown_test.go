@@ -0,0 +1,59 @@
+package notion
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/kloset/snapshot/exporter"
+)
+
+func TestExportMarkdownTree(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	os.RemoveAll(tempDir)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+	dir := t.TempDir()
+	exp, err := NewNotionExporter(context.Background(), &exporter.Options{}, "notion", map[string]string{"format": "markdown", "path": dir})
+	if err != nil {
+		t.Fatalf("NewNotionExporter: %v", err)
+	}
+	restoreSnapshot(t, exp, files)
+
+	hex := func(id string) string { return strings.ReplaceAll(id, "-", "") }
+	spec := "Spec " + hex(f.page)
+	read := func(pathname string) string {
+		t.Helper()
+		data, err := os.ReadFile(path.Join(dir, pathname))
+		if err != nil {
+			t.Fatalf("failed to read the export: %v", err)
+		}
+		return string(data)
+	}
+
+	page := read(spec + ".md")
+	for _, want := range []string{
+		"---\ntitle: \"Spec\"\nid: \"" + f.page + "\"\nicon: \"Spec%20" + hex(f.page) + "/icon.png\"\n---\n\n# Spec\n",
+		"![image](Spec%20" + hex(f.page) + "/" + f.image + ".jpg)",
+		"[Child](Spec%20" + hex(f.page) + "/Child%20" + hex(f.child) + ".md)",
+		"[Tasks](Spec%20" + hex(f.page) + "/Tasks%20" + hex(f.database) + ".csv)",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page is missing %q:\n%s", want, page)
+		}
+	}
+	if got := read(spec + "/" + f.image + ".jpg"); got != "image-bytes" {
+		t.Errorf("image content = %q", got)
+	}
+	if got := read(spec + "/Child " + hex(f.child) + ".md"); !strings.HasSuffix(got, "# Child\n\nchild text\n") {
+		t.Errorf("child page = %q", got)
+	}
+	if got := read(spec + "/Tasks " + hex(f.database) + ".csv"); got != "Name\nTask 1\n" {
+		t.Errorf("database CSV = %q", got)
+	}
+	read(spec + "/Tasks " + hex(f.database) + "/Task 1 " + hex(f.row) + ".md")
+}
@@ -0,0 +1,76 @@
+package notion
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sync/atomic"
+)
+
+// Log levels, set with the log_level option. Page contents and request
+// bodies are only logged at the debug level, and tokens never are.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levels = []string{LevelDebug, LevelInfo, LevelWarn, LevelError}
+
+// logLevel is the index in levels of the lowest level logged.
+var logLevel atomic.Int32
+
+func init() {
+	logLevel.Store(1)
+}
+
+// setLogLevel sets the level logged from the log_level option of a
+// connector configuration, info by default.
+func setLogLevel(config map[string]string) error {
+	value, ok := config["log_level"]
+	if !ok {
+		value = LevelInfo
+	}
+	for i, level := range levels {
+		if level == value {
+			logLevel.Store(int32(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid log_level value %q: must be %q, %q, %q or %q", value, LevelDebug, LevelInfo, LevelWarn, LevelError)
+}
+
+// secretPattern matches the tokens of integrations, OAuth access tokens
+// included, and bearer credentials.
+var secretPattern = regexp.MustCompile(`\b(ntn_|secret_)[A-Za-z0-9]+|Bearer [^\s"]+`)
+
+// redact hides the secrets found in s.
+func redact(s string) string {
+	return secretPattern.ReplaceAllString(s, "[redacted]")
+}
+
+func logf(level int32, prefix, format string, args ...any) {
+	if level < logLevel.Load() {
+		return
+	}
+	log.Print(prefix + redact(fmt.Sprintf(format, args...)))
+}
+
+// debugf logs what helps tracing a backup or a restore, request bodies
+// included.
+func debugf(format string, args ...any) {
+	logf(0, "debug: ", format, args...)
+}
+
+func infof(format string, args ...any) {
+	logf(1, "", format, args...)
+}
+
+func warnf(format string, args ...any) {
+	logf(2, "warning: ", format, args...)
+}
+
+func errorf(format string, args ...any) {
+	logf(3, "error: ", format, args...)
+}
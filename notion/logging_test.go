@@ -0,0 +1,69 @@
+package notion
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	for in, want := range map[string]string{
+		"token ntn_abc123 rejected":          "token [redacted] rejected",
+		"token secret_XYZ rejected":          "token [redacted] rejected",
+		`{"Authorization":"Bearer abc.def"}`: `{"Authorization":"[redacted]"}`,
+		"page 59833787 not found":            "page 59833787 not found",
+	} {
+		if got := redact(in); got != want {
+			t.Errorf("redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	src := newMockNotion(t)
+	newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+
+	// page contents are only logged at the debug level
+	for level, logged := range map[string]bool{LevelInfo: false, LevelDebug: true} {
+		buf.Reset()
+		dst := newMockNotion(t)
+		root := dst.AddPage("workspace", "", "Restore")
+		exp, _ := newTestExporter(t, dst, root, map[string]string{"log_level": level})
+		restoreSnapshot(t, exp, files)
+		if got := strings.Contains(buf.String(), `"plain_text":"Child"`); got != logged {
+			t.Errorf("log_level=%s: page content logged = %v:\n%s", level, got, buf.String())
+		}
+		if strings.Contains(buf.String(), mockToken) {
+			t.Errorf("log_level=%s: token logged:\n%s", level, buf.String())
+		}
+	}
+	if err := setLogLevel(map[string]string{"log_level": "verbose"}); err == nil {
+		t.Errorf("expected an invalid log_level error")
+	}
+	setLogLevel(nil)
+}
+
+func TestAPIError(t *testing.T) {
+	m := newMockNotion(t)
+	c := newClient(m.baseURL(), mockToken)
+
+	_, err := c.fetchFromURL(c.url("/pages/%s", "missing"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.Status != 404 || apiErr.Code != "object_not_found" || apiErr.ObjectID != "missing" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+	if !strings.Contains(err.Error(), "object_not_found") || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("error = %q", err)
+	}
+}
@@ -0,0 +1,235 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+// manifestFormat is the version of the manifest layout, raised when a
+// snapshot can't be restored by older exporters.
+const manifestFormat = 1
+
+// manifest describes how a snapshot was taken and how complete it is. It
+// is saved as /manifest.json at the root of the snapshot.
+type manifest struct {
+	Format      int               `json:"format"`
+	APIVersion  string            `json:"api_version"` // Notion-Version the snapshot was taken with
+	Bot         string            `json:"bot,omitempty"`
+	BotID       string            `json:"bot_id,omitempty"`
+	Workspace   string            `json:"workspace,omitempty"`
+	Started     time.Time         `json:"started"`
+	Finished    time.Time         `json:"finished"`
+	Counts      manifestCounts    `json:"counts"`
+	Skipped     map[string]int    `json:"skipped_blocks,omitempty"`     // block type -> count, blocks saved without their content
+	Unsupported map[string]int    `json:"unsupported_blocks,omitempty"` // block type -> count, blocks the API doesn't expose
+	Excluded    map[string]int    `json:"excluded,omitempty"`           // object or block type -> count, left out by the exclude option
+	Omitted     map[string]string `json:"omitted,omitempty"`            // file -> why it isn't in the snapshot
+	Orphans     []manifestOrphan  `json:"orphans,omitempty"`            // pages whose parent the integration can't see
+	Failures    []manifestFailure `json:"failures,omitempty"`
+}
+
+type manifestCounts struct {
+	Pages       int `json:"pages"`
+	Databases   int `json:"databases"`
+	DataSources int `json:"data_sources,omitempty"`
+	Rows        int `json:"rows"`
+	Blocks      int `json:"blocks"`
+	Files       int `json:"files"`
+	Archived    int `json:"archived,omitempty"` // pages and databases saved from the trash
+}
+
+// manifestFailure is an object of the workspace that couldn't be saved.
+type manifestFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// manifestOrphan is a page whose parent isn't shared with the integration.
+type manifestOrphan struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Parent string `json:"parent"`         // ID of the parent that can't be seen
+	Path   string `json:"path,omitempty"` // where it is saved, empty when left out
+}
+
+// scanStats collects the statistics of a backup for its manifest. It is
+// updated from the scan goroutines and the readers.
+type scanStats struct {
+	mu          sync.Mutex
+	started     time.Time
+	blocks      int
+	files       int
+	skipped     map[string]int
+	unsupported map[string]int
+	excluded    map[string]int
+	omitted     map[string]string
+	orphans     []manifestOrphan
+	failures    []manifestFailure
+}
+
+func newScanStats() *scanStats {
+	return &scanStats{
+		skipped:     make(map[string]int),
+		unsupported: make(map[string]int),
+		excluded:    make(map[string]int),
+		omitted:     make(map[string]string),
+	}
+}
+
+func (s *scanStats) block() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks++
+}
+
+func (s *scanStats) file() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files++
+}
+
+func (s *scanStats) skip(blockType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped[blockType]++
+}
+
+func (s *scanStats) unsupportedBlock(blockType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsupported[blockType]++
+}
+
+func (s *scanStats) exclude(kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.excluded[kind]++
+}
+
+func (s *scanStats) omit(name, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.omitted[name] = reason
+}
+
+func (s *scanStats) orphan(o manifestOrphan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orphans = append(s.orphans, o)
+}
+
+func (s *scanStats) fail(pathname string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, manifestFailure{Path: pathname, Error: err.Error()})
+}
+
+// scanError reports an object that couldn't be saved, both to plakar and
+// in the manifest.
+func (p *NotionImporter) scanError(results chan<- *importer.ScanResult, pathname string, err error) {
+	p.stats.fail(pathname, err)
+	results <- importer.NewScanError(pathname, err)
+}
+
+// unsupportedType returns the type of a block the API can't return, when
+// it tells which.
+func unsupportedType(block json.RawMessage) string {
+	var b struct {
+		Unsupported struct {
+			BlockType string `json:"block_type"`
+		} `json:"unsupported"`
+	}
+	if err := json.Unmarshal(block, &b); err != nil || b.Unsupported.BlockType == "" {
+		return "unsupported"
+	}
+	return b.Unsupported.BlockType
+}
+
+// newManifestReader writes the manifest once every other file of the
+// snapshot has been read, see fileRecord.
+func (p *NotionImporter) newManifestReader() (io.Reader, error) {
+	m := manifest{
+		Format:     manifestFormat,
+		APIVersion: p.client.version,
+		Started:    p.stats.started,
+		Finished:   time.Now(),
+	}
+
+	if p.bot != nil {
+		m.Bot = p.bot.Name
+		m.BotID = p.bot.ID
+		m.Workspace = p.bot.workspace()
+	}
+
+	for _, entry := range p.tree.saved() {
+		if entry.page.archived() {
+			m.Counts.Archived++
+		}
+		switch entry.page.Object {
+		case "page":
+			if isRowParent(entry.page.Parent["type"]) {
+				m.Counts.Rows++
+			} else {
+				m.Counts.Pages++
+			}
+		case "database":
+			m.Counts.Databases++
+		case "data_source":
+			m.Counts.DataSources++
+		}
+	}
+
+	p.stats.mu.Lock()
+	m.Counts.Blocks = p.stats.blocks
+	m.Counts.Files = p.stats.files
+	m.Skipped = p.stats.skipped
+	m.Unsupported = p.stats.unsupported
+	m.Excluded = p.stats.excluded
+	m.Omitted = p.stats.omitted
+	m.Orphans = p.stats.orphans
+	m.Failures = p.stats.failures
+	data, err := json.Marshal(m)
+	p.stats.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// checkManifest reads the manifest of the restored snapshot, if any, and
+// checks that it can be restored. Snapshots taken before manifests existed,
+// and subpaths of a snapshot, have none.
+func (n *NotionExporter) checkManifest() error {
+	data, err := os.ReadFile(path.Join(tempDir, "manifest.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	if m.Format > manifestFormat {
+		return fmt.Errorf("snapshot manifest format %d is not supported, this exporter reads up to %d", m.Format, manifestFormat)
+	}
+	if len(m.Failures) > 0 {
+		warnf("snapshot is incomplete: %d objects failed during the backup", len(m.Failures))
+	}
+	if n.format == FormatNotion && m.APIVersion >= DataSourcesVersion && !n.client.dataSources() {
+		warnf("snapshot was taken with API version %s, restoring with %s keeps the first data source of each database", m.APIVersion, n.client.version)
+	}
+	return nil
+}
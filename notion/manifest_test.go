@@ -0,0 +1,70 @@
+package notion
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestScanWritesManifest(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	m.AddBlock(f.child, "image", map[string]any{"type": "external", "external": map[string]any{"url": "https://example.com/a.png"}})
+	m.AddBlock(f.child, "unsupported", map[string]any{"block_type": "form"})
+
+	files := scanSnapshot(t, newTestImporter(t, m, nil))
+	got := decodeFile[manifest](t, files, "/manifest.json")
+
+	want := manifestCounts{Pages: 2, Databases: 1, Rows: 1, Blocks: 9, Files: 2}
+	if got.Counts != want {
+		t.Errorf("counts = %+v, want %+v", got.Counts, want)
+	}
+	if got.APIVersion != NotionVersionHeader || got.Bot != "Backup" || got.Workspace != "Acme" {
+		t.Errorf("manifest = %+v", got)
+	}
+	if got.Skipped["image (external)"] != 1 || got.Unsupported["form"] != 1 {
+		t.Errorf("skipped = %v, unsupported = %v", got.Skipped, got.Unsupported)
+	}
+	if got.Started.IsZero() || got.Finished.Before(got.Started) {
+		t.Errorf("started %v, finished %v", got.Started, got.Finished)
+	}
+
+	// a manifest from a newer format is refused before anything is created
+	files["/manifest.json"] = []byte(strings.Replace(string(files["/manifest.json"]), `"format":1`, `"format":2`, 1))
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, nil)
+	ctx := context.Background()
+	for pathname, data := range files {
+		exp.CreateDirectory(ctx, pathname[:strings.LastIndex(pathname, "/")+1])
+		exp.StoreFile(ctx, pathname, strings.NewReader(string(data)), int64(len(data)))
+	}
+	if err := exp.Close(ctx); err == nil || !strings.Contains(err.Error(), "manifest format 2") {
+		t.Errorf("Close = %v, want a manifest format error", err)
+	}
+	if len(childTitles(dst, root)) != 0 {
+		t.Errorf("objects were restored despite the error")
+	}
+}
+
+func TestManifestListsFailedFiles(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	imp := newTestImporter(t, m, nil)
+	// the capability is checked when the importer is created
+	m.Deny("read_comments")
+
+	files, failed := scanSnapshotFailures(t, imp)
+	commentsPath := "/" + f.page + "/comments.json"
+	if _, ok := failed[commentsPath]; !ok {
+		t.Fatalf("reading %s didn't fail: %v", commentsPath, failed)
+	}
+	got := decodeFile[manifest](t, files, "/manifest.json")
+	var listed bool
+	for _, failure := range got.Failures {
+		listed = listed || failure.Path == commentsPath
+	}
+	if !listed {
+		t.Errorf("manifest failures %+v don't list %s", got.Failures, commentsPath)
+	}
+}
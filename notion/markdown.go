@@ -0,0 +1,272 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// blockLinks resolves the links of a rendered page. rel is the directory
+// of the current block container relative to the page, ending with a slash
+// or empty for the page itself.
+type blockLinks struct {
+	asset    func(rel string, block map[string]any) string // "" when the file is not available
+	page     func(rel, id string) string
+	database func(rel, id string) string
+}
+
+// snapshotLinks resolves links within a snapshot: images are saved next to
+// the blocks.json or page.json listing them, and child pages and databases
+// live in a directory named after their ID, holding pageFile or
+// databaseFile.
+func snapshotLinks(pageFile, databaseFile string) blockLinks {
+	return blockLinks{
+		asset: func(rel string, block map[string]any) string {
+			content, _ := block["image"].(map[string]any)
+			if content["type"] != "file" {
+				return ""
+			}
+			return rel + block["id"].(string) + ".jpg"
+		},
+		page: func(rel, id string) string {
+			return rel + id + "/" + pageFile
+		},
+		database: func(rel, id string) string {
+			return rel + id + "/" + databaseFile
+		},
+	}
+}
+
+// markdownRenderer renders Notion blocks as Markdown. children returns the
+// child blocks of a page or block, rel being the directory of these children
+// relative to the page.
+type markdownRenderer struct {
+	children func(rel, id string) []map[string]any
+	links    blockLinks
+}
+
+// renderPage renders a page titled title with its blocks.
+func (r *markdownRenderer) renderPage(title, id string) string {
+	var sb strings.Builder
+	if title != "" {
+		fmt.Fprintf(&sb, "# %s\n\n", title)
+	}
+	r.renderBlocks(&sb, r.children("", id), "", "")
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+func (r *markdownRenderer) renderBlocks(sb *strings.Builder, blocks []map[string]any, rel, indent string) {
+	for i, block := range blocks {
+		r.renderBlock(sb, block, rel, indent)
+
+		// consecutive list items are kept together
+		if i+1 < len(blocks) && isListItem(block["type"]) && block["type"] == blocks[i+1]["type"] {
+			continue
+		}
+		sb.WriteString("\n")
+	}
+}
+
+func isListItem(blockType any) bool {
+	switch blockType {
+	case "bulleted_list_item", "numbered_list_item", "to_do":
+		return true
+	}
+	return false
+}
+
+func (r *markdownRenderer) renderBlock(sb *strings.Builder, block map[string]any, rel, indent string) {
+	blockType, _ := block["type"].(string)
+	id, _ := block["id"].(string)
+	content, _ := block[blockType].(map[string]any)
+	rt, _ := content["rich_text"].([]any)
+	text := markdownText(rt)
+	hasChildren, _ := block["has_children"].(bool)
+	childRel := rel + id + "/"
+
+	switch blockType {
+	case "paragraph":
+		fmt.Fprintf(sb, "%s%s\n", indent, text)
+	case "heading_1", "heading_2", "heading_3":
+		level := strings.Repeat("#", int(blockType[len(blockType)-1]-'0'))
+		fmt.Fprintf(sb, "%s%s %s\n", indent, level, text)
+	case "bulleted_list_item":
+		fmt.Fprintf(sb, "%s- %s\n", indent, text)
+	case "numbered_list_item":
+		fmt.Fprintf(sb, "%s1. %s\n", indent, text)
+	case "to_do":
+		mark := " "
+		if checked, _ := content["checked"].(bool); checked {
+			mark = "x"
+		}
+		fmt.Fprintf(sb, "%s- [%s] %s\n", indent, mark, text)
+	case "quote":
+		fmt.Fprintf(sb, "%s> %s\n", indent, strings.ReplaceAll(text, "\n", "\n"+indent+"> "))
+	case "callout":
+		icon := ""
+		if emoji, ok := content["icon"].(map[string]any); ok && emoji["type"] == "emoji" {
+			icon, _ = emoji["emoji"].(string)
+			icon += " "
+		}
+		fmt.Fprintf(sb, "%s> %s%s\n", indent, icon, strings.ReplaceAll(text, "\n", "\n"+indent+"> "))
+	case "code":
+		language, _ := content["language"].(string)
+		if language == "plain text" {
+			language = ""
+		}
+		fmt.Fprintf(sb, "%s```%s\n%s%s\n%s```\n", indent, language, indent, strings.ReplaceAll(plainText(rt), "\n", "\n"+indent), indent)
+	case "equation":
+		expression, _ := content["expression"].(string)
+		fmt.Fprintf(sb, "%s$$\n%s%s\n%s$$\n", indent, indent, expression, indent)
+	case "divider":
+		fmt.Fprintf(sb, "%s---\n", indent)
+	case "toggle":
+		fmt.Fprintf(sb, "%s<details>\n%s<summary>%s</summary>\n\n", indent, indent, text)
+		if hasChildren {
+			r.renderBlocks(sb, r.children(childRel, id), childRel, indent)
+		}
+		fmt.Fprintf(sb, "%s</details>\n", indent)
+		return
+	case "table":
+		r.renderTable(sb, r.children(childRel, id), indent)
+		return
+	case "image", "file", "pdf", "video", "audio":
+		caption, _ := content["caption"].([]any)
+		label := plainText(caption)
+		if label == "" {
+			label = blockType
+		}
+		target := r.links.asset(rel, block)
+		if target == "" {
+			target = fileURL(content)
+		}
+		prefix := ""
+		if blockType == "image" {
+			prefix = "!"
+		}
+		fmt.Fprintf(sb, "%s%s[%s](%s)\n", indent, prefix, label, target)
+	case "bookmark", "embed", "link_preview":
+		u, _ := content["url"].(string)
+		fmt.Fprintf(sb, "%s<%s>\n", indent, u)
+	case "child_page":
+		title, _ := content["title"].(string)
+		fmt.Fprintf(sb, "%s[%s](%s)\n", indent, title, r.links.page(rel, id))
+		return
+	case "child_database":
+		title, _ := content["title"].(string)
+		fmt.Fprintf(sb, "%s[%s](%s)\n", indent, title, r.links.database(rel, id))
+		return
+	case "column_list", "column", "synced_block", "table_of_contents", "breadcrumb":
+		// layout blocks, only their children are rendered
+	default:
+		if text != "" {
+			fmt.Fprintf(sb, "%s%s\n", indent, text)
+		}
+	}
+
+	if hasChildren {
+		childIndent := indent
+		if isListItem(blockType) {
+			childIndent += "  "
+		}
+		children := r.children(childRel, id)
+		if !isListItem(blockType) && len(children) > 0 {
+			sb.WriteString("\n")
+		}
+		r.renderBlocks(sb, children, childRel, childIndent)
+	}
+}
+
+func (r *markdownRenderer) renderTable(sb *strings.Builder, rows []map[string]any, indent string) {
+	for i, row := range rows {
+		content, _ := row["table_row"].(map[string]any)
+		cells, _ := content["cells"].([]any)
+		texts := make([]string, len(cells))
+		for j, cell := range cells {
+			rt, _ := cell.([]any)
+			texts[j] = strings.ReplaceAll(markdownText(rt), "|", "\\|")
+		}
+		fmt.Fprintf(sb, "%s| %s |\n", indent, strings.Join(texts, " | "))
+		if i == 0 {
+			fmt.Fprintf(sb, "%s|%s\n", indent, strings.Repeat(" --- |", len(cells)))
+		}
+	}
+}
+
+// fileURL returns the URL of an external or hosted file block.
+func fileURL(content map[string]any) string {
+	for _, key := range []string{"external", "file"} {
+		if inner, ok := content[key].(map[string]any); ok {
+			u, _ := inner["url"].(string)
+			return u
+		}
+	}
+	return ""
+}
+
+// markdownText renders a rich text array with its annotations and links.
+func markdownText(richText []any) string {
+	var sb strings.Builder
+	for _, t := range richText {
+		r, _ := t.(map[string]any)
+		text, _ := r["plain_text"].(string)
+		if text == "" {
+			text = plainText([]any{r})
+		}
+
+		if r["type"] == "equation" {
+			sb.WriteString("$" + text + "$")
+			continue
+		}
+
+		annotations, _ := r["annotations"].(map[string]any)
+		if code, _ := annotations["code"].(bool); code {
+			text = "`" + text + "`"
+		}
+		if bold, _ := annotations["bold"].(bool); bold {
+			text = "**" + text + "**"
+		}
+		if italic, _ := annotations["italic"].(bool); italic {
+			text = "*" + text + "*"
+		}
+		if strike, _ := annotations["strikethrough"].(bool); strike {
+			text = "~~" + text + "~~"
+		}
+		if href, ok := r["href"].(string); ok && href != "" {
+			text = "[" + text + "](" + href + ")"
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// decodeBlocks decodes raw blocks, skipping the ones that aren't objects.
+func decodeBlocks(raw []json.RawMessage) []map[string]any {
+	blocks := make([]map[string]any, 0, len(raw))
+	for _, r := range raw {
+		var block map[string]any
+		if err := json.Unmarshal(r, &block); err == nil {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// newMarkdownReader renders the page.md of a page from the blocks read for
+// its page.json and blocks.json files.
+func (p *NotionImporter) newMarkdownReader(id string) (io.Reader, error) {
+	page, ok := p.tree.page(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown page %s", id)
+	}
+	r := &markdownRenderer{
+		children: func(rel, id string) []map[string]any {
+			return decodeBlocks(p.blocks[id])
+		},
+		links: snapshotLinks("page.md", "database.json"),
+	}
+	title := titleOf(map[string]any{"properties": page.Properties})
+	return bytes.NewReader([]byte(r.renderPage(title, id))), nil
+}
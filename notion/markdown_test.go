@@ -0,0 +1,44 @@
+package notion
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanRendersMarkdown(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	m.AddBlock(f.page, "heading_2", map[string]any{"rich_text": richText("Steps")})
+	m.AddBlock(f.page, "to_do", map[string]any{"rich_text": richText("write"), "checked": true})
+	m.AddBlock(f.page, "to_do", map[string]any{"rich_text": richText("review"), "checked": false})
+	m.AddBlock(f.page, "code", map[string]any{"rich_text": richText("go test ./..."), "language": "shell"})
+	table := m.AddBlock(f.page, "table", map[string]any{"table_width": 2, "has_column_header": true})
+	m.AddBlock(table, "table_row", map[string]any{"cells": []any{richText("name"), richText("value")}})
+	m.AddBlock(table, "table_row", map[string]any{"cells": []any{richText("a|b"), richText("1")}})
+
+	files := scanSnapshot(t, newTestImporter(t, m, map[string]string{"markdown": "true"}))
+
+	page := string(files["/"+f.page+"/page.md"])
+	for _, want := range []string{
+		"# Spec\n\nhello\n\n",
+		"<details>\n<summary>more</summary>\n\nhidden\n\n</details>\n",
+		"![image](" + f.image + ".jpg)\n",
+		"[Child](" + f.child + "/page.md)\n",
+		"[Tasks](" + f.database + "/database.json)\n",
+		"## Steps\n",
+		"- [x] write\n- [ ] review\n",
+		"```shell\ngo test ./...\n```\n",
+		"| name | value |\n| --- | --- |\n| a\\|b | 1 |\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page.md is missing %q:\n%s", want, page)
+		}
+	}
+
+	if got := string(files["/"+f.page+"/"+f.child+"/page.md"]); got != "# Child\n\nchild text\n" {
+		t.Errorf("child page.md = %q", got)
+	}
+	if _, ok := files["/"+f.page+"/"+f.database+"/"+f.row+"/page.md"]; !ok {
+		t.Errorf("row page.md missing from the snapshot")
+	}
+}
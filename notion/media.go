@@ -0,0 +1,249 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// mediaKeys are the page and database fields holding an image that may be
+// hosted by Notion.
+var mediaKeys = []string{"icon", "cover"}
+
+// hostedMediaURL returns the download URL of an icon or cover when the image
+// is hosted by Notion, or an empty string for emojis and external images.
+// Hosted URLs are signed and expire, so the image itself has to be saved.
+func hostedMediaURL(media map[string]any) string {
+	var inner map[string]any
+	switch media["type"] {
+	case "file":
+		inner, _ = media["file"].(map[string]any)
+	case "custom_emoji":
+		inner, _ = media["custom_emoji"].(map[string]any)
+	default:
+		return ""
+	}
+	u, _ := inner["url"].(string)
+	return u
+}
+
+// mediaFileName returns the snapshot name of a saved icon or cover, keeping
+// the extension of the original file when there is one.
+func mediaFileName(key, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return key
+	}
+	return key + path.Ext(u.Path)
+}
+
+// isMediaFile reports whether name is a saved icon or cover.
+func isMediaFile(name string) (string, bool) {
+	key := strings.TrimSuffix(name, path.Ext(name))
+	for _, k := range mediaKeys {
+		if key == k {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// newMediaReader downloads the icon or cover of a page or database. The
+// object is fetched again so that the signed URL is fresh, even for files
+// read long after the search that discovered them.
+func (p *NotionImporter) newMediaReader(id, key string) (io.ReadCloser, error) {
+	object := "pages"
+	if page, ok := p.tree.page(id); ok && page.Object == "database" {
+		object = "databases"
+	}
+
+	header, err := p.client.fetchFromURL(p.client.url("/%s/%s", object, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s of %s: %w", key, id, err)
+	}
+	media, _ := header[key].(map[string]any)
+	mediaURL := hostedMediaURL(media)
+	if mediaURL == "" {
+		return nil, fmt.Errorf("%s of %s is no longer hosted by Notion", key, id)
+	}
+
+	resp, err := p.client.fetchFile(mediaURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s of %s: %w", key, id, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s of %s, status code: %d", key, id, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// findMediaFile returns the path of the saved icon or cover in dir, if any.
+func findMediaFile(dir, key string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if k, ok := isMediaFile(entry.Name()); ok && k == key && !entry.IsDir() {
+			return path.Join(dir, entry.Name()), true
+		}
+	}
+	return "", false
+}
+
+// restoreMedia rewrites the icon and cover of a page or database payload so
+// that they can be created in the target workspace. Notion-hosted images are
+// uploaded again from the snapshot, custom emojis are looked up by name and
+// fall back to their saved image, and anything that can't be restored is
+// dropped rather than failing the whole page.
+func (n *NotionExporter) restoreMedia(payload map[string]any, dir string) error {
+	for _, key := range mediaKeys {
+		media, ok := payload[key].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		switch media["type"] {
+		case "file":
+		case "custom_emoji":
+			emoji, _ := media["custom_emoji"].(map[string]any)
+			name, _ := emoji["name"].(string)
+			if emojiID := n.findCustomEmoji(name); emojiID != "" {
+				payload[key] = map[string]any{
+					"type":         "custom_emoji",
+					"custom_emoji": map[string]any{"id": emojiID},
+				}
+				continue
+			}
+			warnf("custom emoji %q not found in the target workspace, using its image", name)
+		default:
+			continue
+		}
+
+		pathname, ok := findMediaFile(dir, key)
+		if !ok {
+			warnf("no saved %s in %s, dropping it", key, dir)
+			n.plan.transform(key + " dropped")
+			delete(payload, key)
+			continue
+		}
+		uploadID, err := n.uploadFile(pathname)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		payload[key] = map[string]any{
+			"type":        "file_upload",
+			"file_upload": map[string]any{"id": uploadID},
+		}
+	}
+	return nil
+}
+
+// findCustomEmoji returns the ID of the custom emoji with the given name in
+// the target workspace, or an empty string if there is none.
+func (n *NotionExporter) findCustomEmoji(name string) string {
+	if name == "" {
+		return ""
+	}
+	if n.plan != nil {
+		n.plan.requests++
+		n.plan.transform("custom emoji looked up by name")
+		return ""
+	}
+
+	jsonData, err := n.client.makeRequest("GET", n.client.url("/custom_emojis?name=%s", url.QueryEscape(name)), nil)
+	if err != nil {
+		warnf("failed to look up custom emoji %q: %v", name, err)
+		return ""
+	}
+	results, _ := jsonData["results"].([]any)
+	for _, result := range results {
+		emoji, _ := result.(map[string]any)
+		if emoji["name"] == name {
+			id, _ := emoji["id"].(string)
+			return id
+		}
+	}
+	return ""
+}
+
+// uploadFile sends a local file through the Notion file upload API and
+// returns the ID to reference it from a page, block, icon or cover.
+func (n *NotionExporter) uploadFile(pathname string) (string, error) {
+	if n.plan != nil {
+		return n.plan.file(), nil
+	}
+
+	filename := path.Base(pathname)
+	contentType := mime.TypeByExtension(path.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	payload := map[string]any{
+		"filename":     filename,
+		"content_type": contentType,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	jsonData, err := n.client.makeRequest("POST", n.client.url("/file_uploads"), data)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file upload: %w", err)
+	}
+	uploadID, _ := jsonData["id"].(string)
+	if uploadID == "" {
+		return "", fmt.Errorf("failed to create file upload: no ID returned")
+	}
+
+	if err := n.sendFile(uploadID, pathname, contentType); err != nil {
+		return "", err
+	}
+	n.progress.complete(kindFile, 1)
+	return uploadID, nil
+}
+
+func (n *NotionExporter) sendFile(uploadID, pathname, contentType string) error {
+	f, err := os.Open(pathname)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", pathname, err)
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreatePart(map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="file"; filename="%s"`, path.Base(pathname))},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create multipart body: %w", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", pathname, err)
+	}
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("failed to create multipart body: %w", err)
+	}
+
+	resp, err := n.client.do("POST", n.client.url("/file_uploads/%s/send", uploadID), mw.FormDataContentType(), body.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to send file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to send file: %w", n.client.apiError(n.client.url("/file_uploads/%s/send", uploadID), resp))
+	}
+	return nil
+}
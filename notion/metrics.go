@@ -0,0 +1,179 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics records how a client uses the Notion API, in a registry of its
+// own. They can be served to Prometheus while the connector runs, see the
+// metrics_listen option, and written in the text exposition format when it
+// is done, see metrics_file.
+type metrics struct {
+	registry    *prometheus.Registry
+	requests    *prometheus.CounterVec   // endpoint, method, status
+	latency     *prometheus.HistogramVec // endpoint, method
+	retries     *prometheus.CounterVec   // endpoint, reason
+	rateLimited *prometheus.CounterVec   // endpoint
+	bytes       *prometheus.CounterVec   // endpoint
+
+	file   string // metrics_file
+	listen string // metrics_listen
+	server *http.Server
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notion_requests_total",
+			Help: "Requests sent to the Notion API, by endpoint and status code.",
+		}, []string{"endpoint", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "notion_request_duration_seconds",
+			Help:    "Time until the response headers of a Notion API request are received.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, []string{"endpoint", "method"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notion_retries_total",
+			Help: "Requests sent again, after a rate limit or with a refreshed access token.",
+		}, []string{"endpoint", "reason"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notion_rate_limited_total",
+			Help: "Requests answered with a 429 status code.",
+		}, []string{"endpoint"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "notion_downloaded_bytes_total",
+			Help: "Bytes of response bodies read, files hosted by Notion included.",
+		}, []string{"endpoint"}),
+	}
+	m.registry.MustRegister(m.requests, m.latency, m.retries, m.rateLimited, m.bytes)
+	return m
+}
+
+// configure sets up the exports of the metrics_file and metrics_listen
+// options of a connector configuration.
+func (m *metrics) configure(config map[string]string) error {
+	m.file = config["metrics_file"]
+	if addr, ok := config["metrics_listen"]; ok {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid metrics_listen value %q: %w", addr, err)
+		}
+		m.listen = addr
+	}
+	return nil
+}
+
+// serve serves the metrics on metrics_listen, until close is called.
+func (m *metrics) serve() error {
+	if m.listen == "" || m.server != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", m.listen)
+	if err != nil {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	m.server = &http.Server{Handler: mux}
+	go func(server *http.Server) {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			warnf("failed to serve metrics: %v", err)
+		}
+	}(m.server)
+	infof("serving metrics on http://%s/metrics", ln.Addr())
+	return nil
+}
+
+// close writes the metrics to metrics_file and stops serving them. A
+// failure is only logged, it doesn't fail the backup or restore.
+func (m *metrics) close() {
+	if m.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		m.server.Shutdown(ctx)
+		m.server = nil
+	}
+	if m.file == "" {
+		return
+	}
+	if err := prometheus.WriteToTextfile(m.file, m.registry); err != nil {
+		warnf("failed to write metrics_file: %v", err)
+	}
+}
+
+// close releases what the client holds once the connector is done, and
+// writes its metrics.
+func (c *client) close() {
+	if c == nil {
+		return
+	}
+	c.metrics.close()
+}
+
+// endpointOf returns the endpoint of an API URL with the object ID
+// replaced, such as "/blocks/{id}/children", to keep the number of label
+// values low.
+func endpointOf(baseURL, url string) string {
+	rest, ok := strings.CutPrefix(url, baseURL)
+	if !ok {
+		return "files"
+	}
+	rest, _, _ = strings.Cut(rest, "?")
+	parts := strings.Split(rest, "/")
+	// "", resource, ID, action
+	if len(parts) > 2 && parts[2] != "me" && parts[2] != "token" {
+		parts[2] = "{id}"
+	}
+	return strings.Join(parts, "/")
+}
+
+// send sends a request and records it in the metrics of the client.
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	endpoint := endpointOf(c.baseURL, req.URL.String())
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.metrics.requests.WithLabelValues(endpoint, req.Method, "error").Inc()
+		return nil, err
+	}
+	c.metrics.latency.WithLabelValues(endpoint, req.Method).Observe(time.Since(start).Seconds())
+	c.metrics.requests.WithLabelValues(endpoint, req.Method, strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.metrics.rateLimited.WithLabelValues(endpoint).Inc()
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, bytes: c.metrics.bytes.WithLabelValues(endpoint)}
+	return resp, nil
+}
+
+// fetchFile downloads a file hosted by Notion, whose signed URL needs no
+// authentication.
+func (c *client) fetchFile(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	return c.send(req)
+}
+
+// countingBody counts the bytes read from a response body.
+type countingBody struct {
+	io.ReadCloser
+	bytes prometheus.Counter
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,59 @@
+package notion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEndpointOf(t *testing.T) {
+	base := "https://api.notion.com/v1"
+	for url, want := range map[string]string{
+		base + "/blocks/59833787-2cf9-4fdf-8782-e53db20768a5/children?page_size=100": "/blocks/{id}/children",
+		base + "/pages/59833787-2cf9-4fdf-8782-e53db20768a5":                         "/pages/{id}",
+		base + "/search":                        "/search",
+		base + "/users/me":                      "/users/me",
+		base + "/comments?block_id=abc":         "/comments",
+		"https://prod-files.s3.amazonaws.com/x": "files",
+	} {
+		if got := endpointOf(base, url); got != want {
+			t.Errorf("endpointOf(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestMetricsFile(t *testing.T) {
+	m := newMockNotion(t)
+	newFixture(m)
+	m.throttle = 5
+
+	file := filepath.Join(t.TempDir(), "notion.prom")
+	imp := newTestImporter(t, m, map[string]string{"metrics_file": file})
+	scanSnapshot(t, imp)
+	if err := imp.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("metrics_file not written: %v", err)
+	}
+	for _, want := range []string{
+		`notion_requests_total{endpoint="/blocks/{id}/children",method="GET",status="200"}`,
+		`status="429"}`,
+		`notion_retries_total{endpoint=`,
+		`notion_rate_limited_total{endpoint=`,
+		`notion_request_duration_seconds_bucket{endpoint="/pages/{id}",method="GET"`,
+		`notion_downloaded_bytes_total{endpoint="files"}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics_file has no %s:\n%s", want, data)
+		}
+	}
+
+	if _, err := newClientFromConfig(map[string]string{"token": mockToken, "metrics_listen": "9464"}); err == nil {
+		t.Errorf("expected an invalid metrics_listen error")
+	}
+}
@@ -0,0 +1,994 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const mockToken = "ntn_mocktoken"
+
+// mockNotion is an in-process stand-in for the Notion API. It keeps pages,
+// databases and blocks in memory, paginates every list with a small page
+// size and can answer some requests with a 429 to exercise retries.
+type mockNotion struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu       sync.Mutex
+	pageSize int // maximum number of results per list page
+	throttle int // every throttle-th request is rate limited, 0 to disable
+	requests int
+	nextID   int
+
+	order    []string                  // pages and databases in creation order
+	objects  map[string]map[string]any // pages, databases and blocks by ID
+	children map[string][]string       // parent ID -> child block IDs
+	comments []map[string]any
+	users    []map[string]any
+	lists    map[string]int    // lists started, by parent ID or "users"
+	files    map[string][]byte // hosted files by name
+	uploads  map[string][]byte // file uploads by ID
+	denied   map[string]bool   // capabilities the integration lacks
+	hidden   map[string]bool   // pages left out of the search
+
+	accessToken  string // OAuth access token accepted along with mockToken
+	refreshToken string // OAuth refresh token, rotated on each exchange
+	grants       int
+}
+
+const (
+	mockClientID     = "client-1"
+	mockClientSecret = "client-secret"
+)
+
+func newMockNotion(t *testing.T) *mockNotion {
+	m := &mockNotion{
+		t:        t,
+		pageSize: 2,
+		objects:  make(map[string]map[string]any),
+		children: make(map[string][]string),
+		files:    make(map[string][]byte),
+		uploads:  make(map[string][]byte),
+		denied:   make(map[string]bool),
+		hidden:   make(map[string]bool),
+		lists:    make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/search", m.search)
+	mux.HandleFunc("GET /v1/pages/{id}", m.getObject("page"))
+	mux.HandleFunc("POST /v1/pages", m.createPage)
+	mux.HandleFunc("PATCH /v1/pages/{id}", m.updateObject("page"))
+	mux.HandleFunc("GET /v1/databases/{id}", m.getObject("database"))
+	mux.HandleFunc("POST /v1/databases", m.createDatabase)
+	mux.HandleFunc("PATCH /v1/databases/{id}", m.updateObject("database"))
+	mux.HandleFunc("POST /v1/databases/{id}/query", m.queryRows("database_id"))
+	mux.HandleFunc("GET /v1/data_sources/{id}", m.getObject("data_source"))
+	mux.HandleFunc("POST /v1/data_sources", m.createDataSource)
+	mux.HandleFunc("POST /v1/data_sources/{id}/query", m.queryRows("data_source_id"))
+	mux.HandleFunc("GET /v1/blocks/{id}", m.getBlock)
+	mux.HandleFunc("GET /v1/blocks/{id}/children", m.listChildren)
+	mux.HandleFunc("PATCH /v1/blocks/{id}/children", m.appendChildren)
+	mux.HandleFunc("GET /v1/comments", m.listComments)
+	mux.HandleFunc("POST /v1/comments", m.createComment)
+	mux.HandleFunc("GET /v1/users", m.listUsers)
+	mux.HandleFunc("GET /v1/users/me", m.getBot)
+	mux.HandleFunc("GET /v1/custom_emojis", m.listCustomEmojis)
+	mux.HandleFunc("POST /v1/file_uploads", m.createUpload)
+	mux.HandleFunc("POST /v1/file_uploads/{id}/send", m.sendUpload)
+	mux.HandleFunc("GET /files/{name}", m.getFile)
+	mux.HandleFunc("POST /v1/oauth/token", m.grantToken)
+
+	m.server = httptest.NewServer(m.middleware(mux))
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockNotion) baseURL() string {
+	return m.server.URL + "/v1"
+}
+
+func (m *mockNotion) fileURL(name string) string {
+	return m.server.URL + "/files/" + name
+}
+
+func (m *mockNotion) requestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests
+}
+
+func (m *mockNotion) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hosted files are served outside of the API, without
+		// authentication nor rate limiting, and the token endpoint
+		// authenticates the client itself.
+		if !strings.HasPrefix(r.URL.Path, "/v1/") || r.URL.Path == "/v1/oauth/token" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.mu.Lock()
+		m.requests++
+		throttled := m.throttle > 0 && m.requests%m.throttle == 0
+		denied := m.denied[capabilityOf(r)]
+		authorized := r.Header.Get("Authorization") == "Bearer "+mockToken ||
+			m.accessToken != "" && r.Header.Get("Authorization") == "Bearer "+m.accessToken
+		m.mu.Unlock()
+
+		if !authorized {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "API token is invalid.")
+			return
+		}
+		if denied {
+			writeError(w, http.StatusForbidden, "restricted_resource", "Insufficient permissions for this endpoint.")
+			return
+		}
+		if throttled {
+			w.Header().Set("Retry-After", "0")
+			writeError(w, http.StatusTooManyRequests, "rate_limited", "You have been rate limited.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Deny removes a capability from the integration: "read_content",
+// "insert_content", "read_comments" or "read_users".
+func (m *mockNotion) Deny(capability string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.denied[capability] = true
+}
+
+// EnableOAuth makes the mock a public integration that grants access
+// tokens for refreshToken.
+func (m *mockNotion) EnableOAuth(refreshToken string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshToken = refreshToken
+}
+
+// ExpireAccessToken makes the OAuth access token given last invalid.
+func (m *mockNotion) ExpireAccessToken() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accessToken = ""
+}
+
+// RefreshToken returns the current OAuth refresh token and the number of
+// access tokens granted.
+func (m *mockNotion) RefreshToken() (string, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.refreshToken, m.grants
+}
+
+func (m *mockNotion) grantToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GrantType    string `json:"grant_type"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	id, secret, _ := r.BasicAuth()
+	if id != mockClientID || secret != mockClientSecret {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed.")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if req.GrantType != "refresh_token" || m.refreshToken == "" || req.RefreshToken != m.refreshToken {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token.")
+		return
+	}
+	m.grants++
+	m.accessToken = fmt.Sprintf("ntn_access%d", m.grants)
+	m.refreshToken = fmt.Sprintf("refresh-%d", m.grants)
+	writeJSON(w, map[string]any{
+		"access_token":  m.accessToken,
+		"refresh_token": m.refreshToken,
+		"token_type":    "bearer",
+		"bot_id":        "bot-1",
+	})
+}
+
+// capabilityOf returns the capability a request needs.
+func capabilityOf(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/comments"):
+		if r.Method == "GET" {
+			return "read_comments"
+		}
+		return "insert_comments"
+	case r.URL.Path == "/v1/users" || strings.HasPrefix(r.URL.Path, "/v1/users/") && r.URL.Path != "/v1/users/me":
+		return "read_users"
+	case r.Method == "GET" || r.URL.Path == "/v1/search" || strings.HasSuffix(r.URL.Path, "/query"):
+		return "read_content"
+	case r.Method == "PATCH" && strings.HasSuffix(r.URL.Path, "/children") || r.Method == "POST":
+		return "insert_content"
+	}
+	return "update_content"
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"object":  "error",
+		"status":  status,
+		"code":    code,
+		"message": message,
+	})
+}
+
+func (m *mockNotion) newID() string {
+	m.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", m.nextID)
+}
+
+// paginate writes one page of a list response, following the cursor and
+// page size of the request.
+func (m *mockNotion) paginate(w http.ResponseWriter, items []any, cursor string, pageSize int) {
+	start, _ := strconv.Atoi(cursor)
+	if pageSize <= 0 || pageSize > m.pageSize {
+		pageSize = m.pageSize
+	}
+	end := min(start+pageSize, len(items))
+	if start > end {
+		start = end
+	}
+
+	resp := map[string]any{
+		"object":      "list",
+		"results":     items[start:end],
+		"has_more":    end < len(items),
+		"next_cursor": nil,
+		"request_id":  "mock",
+	}
+	if end < len(items) {
+		resp["next_cursor"] = strconv.Itoa(end)
+	}
+	writeJSON(w, resp)
+}
+
+func richText(content string) []any {
+	return []any{map[string]any{
+		"type":        "text",
+		"text":        map[string]any{"content": content, "link": nil},
+		"annotations": map[string]any{"bold": false, "italic": false, "code": false},
+		"plain_text":  content,
+		"href":        nil,
+	}}
+}
+
+func parentOf(parentType, parentID string) map[string]any {
+	if parentType == "workspace" {
+		return map[string]any{"type": "workspace", "workspace": true}
+	}
+	return map[string]any{"type": parentType, parentType: parentID}
+}
+
+// AddPage adds a page under the workspace, a page or a database and returns
+// its ID. Pages under a page also get a child_page block in their parent.
+func (m *mockNotion) AddPage(parentType, parentID, title string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addPageLocked(map[string]any{
+		"parent": parentOf(parentType, parentID),
+		"properties": map[string]any{
+			"title": map[string]any{"id": "title", "type": "title", "title": richText(title)},
+		},
+	})
+}
+
+func (m *mockNotion) addPageLocked(body map[string]any) string {
+	id := m.newID()
+	page := map[string]any{
+		"object":           "page",
+		"id":               id,
+		"created_time":     "2025-01-01T00:00:00.000Z",
+		"last_edited_time": "2025-01-01T00:00:00.000Z",
+		"archived":         false,
+		"in_trash":         false,
+		"icon":             nil,
+		"cover":            nil,
+		"url":              "https://www.notion.so/" + id,
+	}
+	for k, v := range body {
+		if k != "children" {
+			page[k] = v
+		}
+	}
+	m.objects[id] = page
+	m.order = append(m.order, id)
+
+	parent := page["parent"].(map[string]any)
+	if parent["type"] == "page_id" {
+		parentID := parent["page_id"].(string)
+		m.objects[id+"#block"] = map[string]any{
+			"object":       "block",
+			"id":           id,
+			"type":         "child_page",
+			"has_children": true,
+			"parent":       parentOf("page_id", parentID),
+			"child_page":   map[string]any{"title": titleOf(page)},
+		}
+		m.children[parentID] = append(m.children[parentID], id+"#block")
+	}
+	return id
+}
+
+// AddDatabase adds a database under a page with a title property named
+// "Name", and returns its ID.
+func (m *mockNotion) AddDatabase(parentID, title string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addDatabaseLocked(map[string]any{
+		"parent": parentOf("page_id", parentID),
+		"title":  richText(title),
+		"properties": map[string]any{
+			"Name": map[string]any{"id": "title", "name": "Name", "type": "title", "title": map[string]any{}},
+		},
+	})
+}
+
+func (m *mockNotion) addDatabaseLocked(body map[string]any) string {
+	id := m.newID()
+	db := map[string]any{
+		"object":       "database",
+		"id":           id,
+		"created_time": "2025-01-01T00:00:00.000Z",
+		"archived":     false,
+		"icon":         nil,
+		"cover":        nil,
+	}
+	for k, v := range body {
+		db[k] = v
+	}
+	m.objects[id] = db
+	m.order = append(m.order, id)
+
+	parentID := db["parent"].(map[string]any)["page_id"].(string)
+	title := titleOf(db)
+	m.objects[id+"#block"] = map[string]any{
+		"object":         "block",
+		"id":             id,
+		"type":           "child_database",
+		"has_children":   false,
+		"parent":         parentOf("page_id", parentID),
+		"child_database": map[string]any{"title": title},
+	}
+	m.children[parentID] = append(m.children[parentID], id+"#block")
+	return id
+}
+
+// AddDataSource adds a data source with a title property named "Name" to
+// a database, and returns its ID. The database then only lists its data
+// sources, as it does with a data source API version.
+func (m *mockNotion) AddDataSource(databaseID, title string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects[databaseID], "properties")
+	return m.addDataSourceLocked(databaseID, richText(title), map[string]any{
+		"Name": map[string]any{"id": "title", "name": "Name", "type": "title", "title": map[string]any{}},
+	})
+}
+
+func (m *mockNotion) addDataSourceLocked(databaseID string, title any, properties any) string {
+	id := m.newID()
+	db := m.objects[databaseID]
+	m.objects[id] = map[string]any{
+		"object":          "data_source",
+		"id":              id,
+		"created_time":    "2025-01-01T00:00:00.000Z",
+		"parent":          parentOf("database_id", databaseID),
+		"database_parent": db["parent"],
+		"title":           title,
+		"properties":      properties,
+	}
+	m.order = append(m.order, id)
+
+	sources, _ := db["data_sources"].([]any)
+	name := titleOf(m.objects[id])
+	db["data_sources"] = append(sources, map[string]any{"id": id, "name": name})
+	return id
+}
+
+// AddRow adds a row titled title to a database or a data source.
+func (m *mockNotion) AddRow(databaseID, title string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parentType := "database_id"
+	if m.objects[databaseID]["object"] == "data_source" {
+		parentType = "data_source_id"
+	}
+	return m.addPageLocked(map[string]any{
+		"parent": parentOf(parentType, databaseID),
+		"properties": map[string]any{
+			"Name": map[string]any{"id": "title", "type": "title", "title": richText(title)},
+		},
+	})
+}
+
+// AddBlock appends a block of the given type to a page or block.
+func (m *mockNotion) AddBlock(parentID, blockType string, content map[string]any) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addBlockLocked(parentID, map[string]any{"type": blockType, blockType: content})
+}
+
+func (m *mockNotion) addBlockLocked(parentID string, body map[string]any) string {
+	id := m.newID()
+	parentType := "page_id"
+	if parent, ok := m.objects[parentID]; ok && parent["object"] == "block" {
+		parentType = "block_id"
+		parent["has_children"] = true
+	}
+
+	block := map[string]any{
+		"object":       "block",
+		"id":           id,
+		"has_children": false,
+		"archived":     false,
+		"parent":       parentOf(parentType, parentID),
+	}
+	for k, v := range body {
+		if k != "id" && k != "parent" && k != "has_children" {
+			block[k] = v
+		}
+	}
+	m.objects[id] = block
+	m.children[parentID] = append(m.children[parentID], id)
+	return id
+}
+
+// AddParagraph appends a paragraph with the given text.
+func (m *mockNotion) AddParagraph(parentID, text string) string {
+	return m.AddBlock(parentID, "paragraph", map[string]any{"rich_text": richText(text)})
+}
+
+// AddComment adds a comment, starting a new discussion, on a page or block.
+func (m *mockNotion) AddComment(parentID, text string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parentType := "page_id"
+	if obj, ok := m.objects[parentID]; ok && obj["object"] == "block" {
+		parentType = "block_id"
+	}
+	return m.addCommentLocked(parentOf(parentType, parentID), m.newID(), text)
+}
+
+func (m *mockNotion) addCommentLocked(parent map[string]any, discussionID, text string) string {
+	id := m.newID()
+	m.comments = append(m.comments, map[string]any{
+		"object":        "comment",
+		"id":            id,
+		"parent":        parent,
+		"discussion_id": discussionID,
+		"created_time":  fmt.Sprintf("2025-01-01T00:00:%02d.000Z", len(m.comments)),
+		"created_by":    map[string]any{"object": "user", "id": "user-1"},
+		"rich_text":     richText(text),
+	})
+	return id
+}
+
+// AddUser adds a person to the workspace.
+func (m *mockNotion) AddUser(id, name, email string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users = append(m.users, map[string]any{
+		"object": "user",
+		"id":     id,
+		"type":   "person",
+		"name":   name,
+		"person": map[string]any{"email": email},
+	})
+}
+
+// AddFile serves content as a Notion-hosted file and returns its URL.
+func (m *mockNotion) AddFile(name string, content []byte) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = content
+	return m.fileURL(name)
+}
+
+// SetIcon sets the icon of a page or database.
+func (m *mockNotion) SetIcon(id string, icon map[string]any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[id]["icon"] = icon
+}
+
+// Archive moves a page or database to the trash: it is left out of the
+// search with its descendants, and of the children of its parent, but can
+// still be fetched by ID.
+func (m *mockNotion) Archive(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[id]["archived"] = true
+	m.objects[id]["in_trash"] = true
+	for parentID, children := range m.children {
+		kept := children[:0]
+		for _, childID := range children {
+			if childID != id+"#block" {
+				kept = append(kept, childID)
+			}
+		}
+		m.children[parentID] = kept
+	}
+}
+
+// HideFromSearch leaves a page out of the search, as one not indexed yet,
+// while it can still be fetched by ID or found by a query.
+func (m *mockNotion) HideFromSearch(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hidden[id] = true
+}
+
+// trashedLocked reports whether an object or one of its ancestors is in
+// the trash.
+func (m *mockNotion) trashedLocked(id string) bool {
+	for obj, ok := m.objects[id]; ok; obj, ok = m.objects[id] {
+		if obj["archived"] == true {
+			return true
+		}
+		parent, _ := obj["parent"].(map[string]any)
+		parentType, _ := parent["type"].(string)
+		id, _ = parent[parentType].(string)
+	}
+	return false
+}
+
+// SetProperty sets a property of a page, or of the schema of a database.
+func (m *mockNotion) SetProperty(id, name string, prop map[string]any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[id]["properties"].(map[string]any)[name] = prop
+}
+
+// Lists returns the number of times the children of a page or block, or
+// the users with "users", were listed.
+func (m *mockNotion) Lists(id string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lists[id]
+}
+
+// SetBlockContent replaces the content of a block, under its type.
+func (m *mockNotion) SetBlockContent(id string, content map[string]any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	block := m.objects[id]
+	block[block["type"].(string)] = content
+}
+
+// Object returns a copy of a page, database or block.
+func (m *mockNotion) Object(id string) map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[id]
+	if !ok {
+		return nil
+	}
+	data, _ := json.Marshal(obj)
+	var c map[string]any
+	json.Unmarshal(data, &c)
+	return c
+}
+
+// Children returns the child blocks of a page or block.
+func (m *mockNotion) Children(id string) []map[string]any {
+	m.mu.Lock()
+	ids := append([]string(nil), m.children[id]...)
+	m.mu.Unlock()
+
+	children := make([]map[string]any, 0, len(ids))
+	for _, childID := range ids {
+		children = append(children, m.Object(childID))
+	}
+	return children
+}
+
+// Rows returns the titles of the rows of a database or data source.
+func (m *mockNotion) Rows(id string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var titles []string
+	for _, pageID := range m.order {
+		page := m.objects[pageID]
+		parent, _ := page["parent"].(map[string]any)
+		if page["object"] == "page" && (parent["database_id"] == id || parent["data_source_id"] == id) {
+			titles = append(titles, titleOf(page))
+		}
+	}
+	return titles
+}
+
+// Comments returns the comments whose parent is id.
+func (m *mockNotion) Comments(id string) []map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var comments []map[string]any
+	for _, c := range m.comments {
+		parent := c["parent"].(map[string]any)
+		if parent[parent["type"].(string)] == id {
+			comments = append(comments, c)
+		}
+	}
+	return comments
+}
+
+func decodeBody(r *http.Request) map[string]any {
+	body := map[string]any{}
+	json.NewDecoder(r.Body).Decode(&body)
+	return body
+}
+
+func (m *mockNotion) search(w http.ResponseWriter, r *http.Request) {
+	body := decodeBody(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// a data source API version returns data sources instead of databases
+	hidden := "data_source"
+	if r.Header.Get("Notion-Version") >= DataSourcesVersion {
+		hidden = "database"
+	}
+	items := make([]any, 0, len(m.order))
+	for _, id := range m.order {
+		if m.objects[id]["object"] != hidden && !m.hidden[id] && !m.trashedLocked(id) {
+			items = append(items, m.objects[id])
+		}
+	}
+	cursor, _ := body["start_cursor"].(string)
+	pageSize, _ := body["page_size"].(float64)
+	m.paginate(w, items, cursor, int(pageSize))
+}
+
+func (m *mockNotion) getObject(object string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		obj, ok := m.objects[r.PathValue("id")]
+		if !ok || obj["object"] != object {
+			writeError(w, http.StatusNotFound, "object_not_found", "Could not find "+object+" with ID: "+r.PathValue("id"))
+			return
+		}
+		writeJSON(w, obj)
+	}
+}
+
+// updateObject only handles moving a page or database to the trash and
+// back.
+func (m *mockNotion) updateObject(object string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := decodeBody(r)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		obj, ok := m.objects[r.PathValue("id")]
+		if !ok || obj["object"] != object {
+			writeError(w, http.StatusNotFound, "object_not_found", "Could not find "+object+" with ID: "+r.PathValue("id"))
+			return
+		}
+		if archived, ok := body["archived"].(bool); ok {
+			obj["archived"] = archived
+			obj["in_trash"] = archived
+		}
+		writeJSON(w, obj)
+	}
+}
+
+func (m *mockNotion) createPage(w http.ResponseWriter, r *http.Request) {
+	body := decodeBody(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, _ := body["parent"].(map[string]any)
+	parentType, _ := parent["type"].(string)
+	if parentType == "" {
+		for _, k := range []string{"page_id", "database_id"} {
+			if _, ok := parent[k]; ok {
+				parentType = k
+			}
+		}
+	}
+	parentID, _ := parent[parentType].(string)
+	if _, ok := m.objects[parentID]; !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find page with ID: "+parentID)
+		return
+	}
+	body["parent"] = parentOf(parentType, parentID)
+
+	id := m.addPageLocked(body)
+	children, _ := body["children"].([]any)
+	for _, child := range children {
+		m.addBlockLocked(id, child.(map[string]any))
+	}
+	writeJSON(w, m.objects[id])
+}
+
+func (m *mockNotion) createDatabase(w http.ResponseWriter, r *http.Request) {
+	body := decodeBody(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, _ := body["parent"].(map[string]any)
+	parentID, _ := parent["page_id"].(string)
+	if _, ok := m.objects[parentID]; !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find page with ID: "+parentID)
+		return
+	}
+	body["parent"] = parentOf("page_id", parentID)
+
+	initial, ok := body["initial_data_source"].(map[string]any)
+	delete(body, "initial_data_source")
+	id := m.addDatabaseLocked(body)
+	if ok {
+		m.addDataSourceLocked(id, body["title"], initial["properties"])
+	}
+	writeJSON(w, m.objects[id])
+}
+
+func (m *mockNotion) createDataSource(w http.ResponseWriter, r *http.Request) {
+	body := decodeBody(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, _ := body["parent"].(map[string]any)
+	databaseID, _ := parent["database_id"].(string)
+	if db, ok := m.objects[databaseID]; !ok || db["object"] != "database" {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find database with ID: "+databaseID)
+		return
+	}
+	id := m.addDataSourceLocked(databaseID, body["title"], body["properties"])
+	writeJSON(w, m.objects[id])
+}
+
+// queryRows lists the rows whose parent, of type parentType, is the
+// database or data source of the request.
+func (m *mockNotion) queryRows(parentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := decodeBody(r)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		parentID := r.PathValue("id")
+		items := []any{}
+		for _, id := range m.order {
+			obj := m.objects[id]
+			if parent, _ := obj["parent"].(map[string]any); obj["object"] == "page" && parent[parentType] == parentID && !m.trashedLocked(id) {
+				items = append(items, obj)
+			}
+		}
+		cursor, _ := body["start_cursor"].(string)
+		pageSize, _ := body["page_size"].(float64)
+		m.paginate(w, items, cursor, int(pageSize))
+	}
+}
+
+func (m *mockNotion) getBlock(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := r.PathValue("id")
+	if block, ok := m.objects[id+"#block"]; ok {
+		writeJSON(w, block)
+		return
+	}
+	obj, ok := m.objects[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find block with ID: "+id)
+		return
+	}
+	if obj["object"] != "block" {
+		// top-level pages are child_page blocks of the workspace
+		writeJSON(w, map[string]any{"object": "block", "id": id, "type": "child_page", "has_children": true, "child_page": map[string]any{"title": titleOf(obj)}})
+		return
+	}
+	writeJSON(w, obj)
+}
+
+func (m *mockNotion) listChildren(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := m.objects[id]; !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find block with ID: "+id)
+		return
+	}
+	if r.URL.Query().Get("start_cursor") == "" {
+		m.lists[id]++
+	}
+	items := []any{}
+	for _, childID := range m.children[id] {
+		items = append(items, m.objects[childID])
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	m.paginate(w, items, r.URL.Query().Get("start_cursor"), pageSize)
+}
+
+func (m *mockNotion) appendChildren(w http.ResponseWriter, r *http.Request) {
+	body := decodeBody(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := m.objects[id]; !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find block with ID: "+id)
+		return
+	}
+	children, _ := body["children"].([]any)
+	if len(children) == 0 {
+		writeError(w, http.StatusBadRequest, "validation_error", "body.children should be defined")
+		return
+	}
+	results := []any{}
+	for _, child := range children {
+		childID := m.addBlockLocked(id, child.(map[string]any))
+		results = append(results, m.objects[childID])
+	}
+	writeJSON(w, map[string]any{"object": "list", "results": results})
+}
+
+func (m *mockNotion) listComments(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	blockID := r.URL.Query().Get("block_id")
+	items := []any{}
+	for _, c := range m.comments {
+		parent := c["parent"].(map[string]any)
+		if parent[parent["type"].(string)] == blockID {
+			items = append(items, c)
+		}
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	m.paginate(w, items, r.URL.Query().Get("start_cursor"), pageSize)
+}
+
+func (m *mockNotion) createComment(w http.ResponseWriter, r *http.Request) {
+	body := decodeBody(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	text := ""
+	rt, _ := body["rich_text"].([]any)
+	for _, t := range rt {
+		inner, _ := t.(map[string]any)["text"].(map[string]any)
+		s, _ := inner["content"].(string)
+		text += s
+	}
+
+	if discussionID, ok := body["discussion_id"].(string); ok {
+		for _, c := range m.comments {
+			if c["discussion_id"] == discussionID {
+				m.addCommentLocked(c["parent"].(map[string]any), discussionID, text)
+				writeJSON(w, m.comments[len(m.comments)-1])
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find discussion with ID: "+discussionID)
+		return
+	}
+
+	parent, _ := body["parent"].(map[string]any)
+	for _, k := range []string{"page_id", "block_id"} {
+		if id, ok := parent[k].(string); ok {
+			if _, exists := m.objects[id]; !exists {
+				break
+			}
+			m.addCommentLocked(parentOf(k, id), m.newID(), text)
+			writeJSON(w, m.comments[len(m.comments)-1])
+			return
+		}
+	}
+	writeError(w, http.StatusBadRequest, "validation_error", "invalid comment parent")
+}
+
+func (m *mockNotion) listUsers(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r.URL.Query().Get("start_cursor") == "" {
+		m.lists["users"]++
+	}
+	items := make([]any, 0, len(m.users))
+	for _, u := range m.users {
+		items = append(items, u)
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	m.paginate(w, items, r.URL.Query().Get("start_cursor"), pageSize)
+}
+
+func (m *mockNotion) getBot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"object": "user",
+		"id":     "bot-1",
+		"type":   "bot",
+		"name":   "Backup",
+		"bot":    map[string]any{"owner": map[string]any{"type": "workspace", "workspace": true}, "workspace_name": "Acme"},
+	})
+}
+
+func (m *mockNotion) listCustomEmojis(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{"object": "list", "results": []any{}, "has_more": false})
+}
+
+func (m *mockNotion) createUpload(w http.ResponseWriter, r *http.Request) {
+	body := decodeBody(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.newID()
+	m.uploads[id] = nil
+	writeJSON(w, map[string]any{"object": "file_upload", "id": id, "status": "pending", "filename": body["filename"]})
+}
+
+func (m *mockNotion) sendUpload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+	content, _ := io.ReadAll(f)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.uploads[id]; !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find file upload with ID: "+id)
+		return
+	}
+	m.uploads[id] = content
+	writeJSON(w, map[string]any{"object": "file_upload", "id": id, "status": "uploaded"})
+}
+
+// DeleteBlock removes a block from its parent.
+func (m *mockNotion) DeleteBlock(parentID, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	children := m.children[parentID][:0]
+	for _, childID := range m.children[parentID] {
+		if childID != id {
+			children = append(children, childID)
+		}
+	}
+	m.children[parentID] = children
+}
+
+// Upload returns the content sent to a file upload.
+func (m *mockNotion) Upload(id string) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.uploads[id]
+}
+
+func (m *mockNotion) getFile(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	content, ok := m.files[r.PathValue("name")]
+	m.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(content)
+}
@@ -5,13 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 )
 
 const (
-	NotionURL           = "https://api.notion.com/v1"
-	PageSize            = 1 // Number of pages to fetch at once default is 100
-	NotionVersionHeader = "2022-06-28"
+	NotionURL           = "https://api.notion.com/v1" // Default base URL, see the base_url option
+	PageSize            = 100                         // Default number of results per list request, see the page_size option
+	NotionVersionHeader = "2022-06-28"                // Default API version, see the api_version option
+	DataSourcesVersion  = "2025-09-03"                // First API version with data sources
+	DefaultWorkers      = 4                           // Default number of block lists fetched in parallel, see the workers option
+	DefaultRateLimit    = 3                           // Default requests per second, Notion's documented average, see the rate_limit option
 )
 
 type notionRecord struct {
@@ -26,33 +28,6 @@ type BlockResponse struct {
 	NextCursor string            `json:"next_cursor"`
 }
 
-func fetchFromURL(url, token string) (map[string]any, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Notion-Version", NotionVersionHeader)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to execute request, status code: %d", resp.StatusCode)
-	}
-
-	var result map[string]any
-	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-	delete(result, "request_id")
-
-	return result, nil
-}
-
 //---------------
 // lets break down the current NotionReader into two:
 // 1. NotionReaderHeader: This will be used to read the header of the page
@@ -60,14 +35,14 @@ func fetchFromURL(url, token string) (map[string]any, error) {
 
 type NotionReaderHeader struct {
 	buf    *bytes.Buffer
-	token  string
+	client *client
 	pageID string
 }
 
-func NewNotionReaderHeader(token, pageID string) (*NotionReaderHeader, error) {
+func NewNotionReaderHeader(c *client, pageID string) (*NotionReaderHeader, error) {
 	nr := &NotionReaderHeader{
 		buf:    new(bytes.Buffer),
-		token:  token,
+		client: c,
 		pageID: pageID,
 	}
 	pageHeader, err := nr.fetchPageHeader()
@@ -84,8 +59,7 @@ func NewNotionReaderHeader(token, pageID string) (*NotionReaderHeader, error) {
 }
 
 func (nr *NotionReaderHeader) fetchPageHeader() (map[string]any, error) {
-	url := fmt.Sprintf("%s/pages/%s", NotionURL, nr.pageID)
-	return fetchFromURL(url, nr.token)
+	return nr.client.fetchFromURL(nr.client.url("/pages/%s", nr.pageID))
 }
 
 func (nr *NotionReaderHeader) Read(p []byte) (int, error) {
@@ -98,7 +72,7 @@ func (nr *NotionReaderHeader) Read(p []byte) (int, error) {
 
 type NotionReaderBlocks struct {
 	buf             *bytes.Buffer
-	token           string
+	client          *client
 	pageID          string
 	path            string
 	cursor          string
@@ -106,13 +80,15 @@ type NotionReaderBlocks struct {
 	blockOpen       bool
 	first           bool
 	wroteFirstBlock bool
-	recordChan      chan<- notionRecord // Channel to send records
+	recordChan      chan<- notionRecord        // Channel to send records
+	skip            func(json.RawMessage) bool // Blocks left out of the backup, may be nil
+	prefetch        *prefetcher                // Blocks fetched ahead of the reader, may be nil
 }
 
-func NewNotionReaderBlocks(token, pageID, path string, recordChan chan<- notionRecord) (*NotionReaderBlocks, error) {
+func NewNotionReaderBlocks(c *client, pageID, path string, recordChan chan<- notionRecord, skip func(json.RawMessage) bool, prefetch *prefetcher) (*NotionReaderBlocks, error) {
 	nRd := &NotionReaderBlocks{
 		buf:             new(bytes.Buffer),
-		token:           token,
+		client:          c,
 		pageID:          pageID,
 		path:            path,
 		cursor:          "",
@@ -121,6 +97,8 @@ func NewNotionReaderBlocks(token, pageID, path string, recordChan chan<- notionR
 		first:           true,
 		wroteFirstBlock: false,
 		recordChan:      recordChan,
+		skip:            skip,
+		prefetch:        prefetch,
 	}
 
 	nRd.buf.WriteString("[")
@@ -128,12 +106,19 @@ func NewNotionReaderBlocks(token, pageID, path string, recordChan chan<- notionR
 }
 
 func (nr *NotionReaderBlocks) fetchBlocks() (*BlockResponse, error) {
-	url := fmt.Sprintf("%s/blocks/%s/children?page_size=%d", NotionURL, nr.pageID, PageSize)
+	if nr.cursor == "" {
+		// the blocks may have been fetched ahead of the reader
+		if blocks, ok, err := nr.prefetch.take(nr.pageID); ok {
+			return &BlockResponse{Results: blocks}, err
+		}
+	}
+
+	url := nr.client.url("/blocks/%s/children?page_size=%d", nr.pageID, nr.client.pageSize)
 	if nr.cursor != "" {
 		url += fmt.Sprintf("&start_cursor=%s", nr.cursor)
 	}
 
-	rawResponse, err := fetchFromURL(url, nr.token)
+	rawResponse, err := nr.client.fetchFromURL(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch blocks: %w", err)
 	}
@@ -164,10 +149,19 @@ func (nr *NotionReaderBlocks) Read(p []byte) (int, error) {
 			return 0, fmt.Errorf("failed to fetch blocks: %w", err)
 		}
 
-		nr.writeBlocksToBuffer(blockResp.Results)
+		blocks := blockResp.Results
+		if nr.skip != nil {
+			blocks = blocks[:0]
+			for _, block := range blockResp.Results {
+				if !nr.skip(block) {
+					blocks = append(blocks, block)
+				}
+			}
+		}
+		nr.writeBlocksToBuffer(blocks)
 
 		// Send each block as a notionRecord to the channel
-		for _, block := range blockResp.Results {
+		for _, block := range blocks {
 			nr.recordChan <- notionRecord{Block: block, EOF: false, pathTo: nr.path}
 		}
 
@@ -218,9 +212,9 @@ type NotionReaderFile struct {
 }
 
 // NewNotionReaderFile creates a new notionReaderFile instance
-func NewNotionReaderFile(token, pageID, path string, recordChan chan<- notionRecord) (*NotionReaderFile, error) {
+func NewNotionReaderFile(c *client, pageID, path string, recordChan chan<- notionRecord, skip func(json.RawMessage) bool, prefetch *prefetcher) (*NotionReaderFile, error) {
 	// Create the header reader
-	headerReader, err := NewNotionReaderHeader(token, pageID)
+	headerReader, err := NewNotionReaderHeader(c, pageID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create NotionReaderHeader: %w", err)
 	}
@@ -230,7 +224,7 @@ func NewNotionReaderFile(token, pageID, path string, recordChan chan<- notionRec
 	headerReader.buf.WriteString(",\"children\":")
 
 	// Create the block reader
-	blockReader, err := NewNotionReaderBlocks(token, pageID, path, recordChan)
+	blockReader, err := NewNotionReaderBlocks(c, pageID, path, recordChan, skip, prefetch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create NotionReaderBlocks: %w", err)
 	}
@@ -265,15 +259,27 @@ func (nrf *NotionReaderFile) Read(p []byte) (int, error) {
 
 type DatabaseNotionReader struct {
 	buf        *bytes.Buffer
-	token      string
+	client     *client
+	endpoint   string // "databases" or "data_sources"
 	databaseID string
 }
 
-func NewNotionReaderDatabase(token, databaseID string) (*DatabaseNotionReader, error) {
+func NewNotionReaderDatabase(c *client, databaseID string) (*DatabaseNotionReader, error) {
+	return newObjectReader(c, "databases", databaseID)
+}
+
+// NewNotionReaderDataSource reads the schema of a data source, saved next
+// to the rows it holds.
+func NewNotionReaderDataSource(c *client, dataSourceID string) (*DatabaseNotionReader, error) {
+	return newObjectReader(c, "data_sources", dataSourceID)
+}
+
+func newObjectReader(c *client, endpoint, id string) (*DatabaseNotionReader, error) {
 	dr := &DatabaseNotionReader{
 		buf:        new(bytes.Buffer),
-		token:      token,
-		databaseID: databaseID,
+		client:     c,
+		endpoint:   endpoint,
+		databaseID: id,
 	}
 
 	// Fetch and write database properties
@@ -285,9 +291,7 @@ func NewNotionReaderDatabase(token, databaseID string) (*DatabaseNotionReader, e
 }
 
 func (dr *DatabaseNotionReader) fetchAndWriteDatabaseProperties() error {
-	url := fmt.Sprintf("%s/databases/%s", NotionURL, dr.databaseID)
-
-	properties, err := fetchFromURL(url, dr.token)
+	properties, err := dr.client.fetchFromURL(dr.client.url("/%s/%s", dr.endpoint, dr.databaseID))
 	if err != nil {
 		return fmt.Errorf("failed to fetch database properties: %w", err)
 	}
@@ -0,0 +1,146 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// oauth holds the credentials of a public integration, which gets access
+// tokens in exchange for a refresh token. Notion may rotate the refresh
+// token on each exchange, the new one is then stored back so that the
+// next backup can use it.
+type oauth struct {
+	clientID     string
+	clientSecret string
+	refreshToken string
+	tokenFile    string // refresh_token_file, rewritten with each new refresh token
+	tokenCmd     string // refresh_token_cmd, run with each new refresh token on its stdin
+}
+
+// oauthFromConfig returns the OAuth credentials of a connector
+// configuration that has a client_id.
+func oauthFromConfig(config map[string]string) (*oauth, error) {
+	for _, name := range tokenSources {
+		if _, ok := config[name]; ok {
+			return nil, fmt.Errorf("conflicting %s and client_id in config, the access token is obtained with the refresh token", name)
+		}
+	}
+	auth := &oauth{
+		clientID:     config["client_id"],
+		clientSecret: config["client_secret"],
+		tokenFile:    config["refresh_token_file"],
+		tokenCmd:     config["refresh_token_cmd"],
+	}
+	if auth.clientSecret == "" {
+		return nil, fmt.Errorf("missing client_secret in config")
+	}
+
+	refreshToken, inline := config["refresh_token"]
+	switch {
+	case inline && auth.tokenFile != "":
+		return nil, fmt.Errorf("conflicting refresh_token and refresh_token_file in config, set only one")
+	case inline:
+		auth.refreshToken = refreshToken
+	case auth.tokenFile != "":
+		data, err := os.ReadFile(auth.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read refresh_token_file: %w", err)
+		}
+		auth.refreshToken = strings.TrimSpace(string(data))
+	}
+	if auth.refreshToken == "" {
+		return nil, fmt.Errorf("missing refresh_token or refresh_token_file in config")
+	}
+	return auth, nil
+}
+
+// refresh exchanges the refresh token for a new access token. stale is the
+// access token a request was rejected with: when another request already
+// replaced it, there is nothing left to do.
+func (c *client) refresh(stale string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != stale {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": c.oauth.refreshToken,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	req, err := http.NewRequest("POST", c.url("/oauth/token"), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(c.oauth.clientID, c.oauth.clientSecret)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Notion-Version", c.version)
+
+	resp, err := c.send(req)
+	if err != nil {
+		return fmt.Errorf("failed to refresh access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to refresh access token: %w", c.apiError(req.URL.String(), resp))
+	}
+
+	var grant struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&grant); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if grant.AccessToken == "" {
+		return fmt.Errorf("failed to refresh access token: no access token in response")
+	}
+	c.token = grant.AccessToken
+
+	if grant.RefreshToken != "" && grant.RefreshToken != c.oauth.refreshToken {
+		c.oauth.refreshToken = grant.RefreshToken
+		// the access token is valid either way, a refresh token that
+		// can't be stored only breaks the next backup
+		if err := c.oauth.store(); err != nil {
+			warnf("failed to store the new refresh token: %v", err)
+		}
+	}
+	return nil
+}
+
+// store saves the current refresh token to refresh_token_file and hands it
+// to refresh_token_cmd.
+func (o *oauth) store() error {
+	if o.tokenFile == "" && o.tokenCmd == "" {
+		warnf("the refresh token was rotated, set refresh_token_file or refresh_token_cmd to keep it")
+		return nil
+	}
+	if o.tokenFile != "" {
+		tmp := filepath.Join(filepath.Dir(o.tokenFile), "."+filepath.Base(o.tokenFile)+".tmp")
+		if err := os.WriteFile(tmp, []byte(o.refreshToken+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to write refresh_token_file: %w", err)
+		}
+		if err := os.Rename(tmp, o.tokenFile); err != nil {
+			return fmt.Errorf("failed to write refresh_token_file: %w", err)
+		}
+	}
+	if o.tokenCmd != "" {
+		var stderr bytes.Buffer
+		cmd := exec.Command("/bin/sh", "-c", o.tokenCmd)
+		cmd.Stdin = strings.NewReader(o.refreshToken + "\n")
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to run refresh_token_cmd: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package notion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+func TestOAuthRefresh(t *testing.T) {
+	m := newMockNotion(t)
+	f := newFixture(m)
+	m.EnableOAuth("refresh-0")
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "refresh_token")
+	if err := os.WriteFile(tokenFile, []byte("refresh-0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmdFile := filepath.Join(dir, "stored")
+	cfg := map[string]string{
+		"base_url":           m.baseURL(),
+		"rate_limit":         "0",
+		"client_id":          mockClientID,
+		"client_secret":      mockClientSecret,
+		"refresh_token_file": tokenFile,
+		"refresh_token_cmd":  "cat > " + cmdFile,
+	}
+	imp, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg)
+	if err != nil {
+		t.Fatalf("NewNotionImporter: %v", err)
+	}
+
+	// the access token expires during the backup
+	m.ExpireAccessToken()
+	files := scanSnapshot(t, imp)
+	decodeFile[map[string]any](t, files, "/"+f.page+"/"+f.child+"/page.json")
+
+	current, grants := m.RefreshToken()
+	if grants != 2 {
+		t.Errorf("%d access tokens granted, want 2", grants)
+	}
+	for _, name := range []string{tokenFile, cmdFile} {
+		data, err := os.ReadFile(name)
+		if err != nil || strings.TrimSpace(string(data)) != current {
+			t.Errorf("%s holds %q, want %q (%v)", filepath.Base(name), data, current, err)
+		}
+	}
+
+	// the next backup starts from the stored refresh token
+	if _, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg); err != nil {
+		t.Fatalf("NewNotionImporter with the stored refresh token: %v", err)
+	}
+
+	cfg["client_secret"] = "wrong"
+	if _, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg); err == nil || !strings.Contains(err.Error(), "failed to refresh access token") {
+		t.Errorf("expected a refresh error, got %v", err)
+	}
+	cfg["client_secret"] = mockClientSecret
+	cfg["token"] = mockToken
+	if _, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg); err == nil || !strings.Contains(err.Error(), "conflicting token and client_id") {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+}
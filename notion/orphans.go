@@ -0,0 +1,140 @@
+package notion
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/kloset/objects"
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+// Handling of the pages whose parent the integration can't see, see the
+// orphans option.
+const (
+	OrphansTop       = "top"       // saved at the top of the snapshot, listed in content.json
+	OrphansDirectory = "directory" // saved under /_orphans
+	OrphansSkip      = "skip"      // left out, only listed in the manifest
+)
+
+const orphansDir = "_orphans"
+
+// adoptOrphans runs once the scan is done, when the pages still waiting
+// for their parent will never get it: the parent isn't shared with the
+// integration. The orphans are saved as the orphans option says, listed in
+// the manifest and in a warning. It returns false when there is nothing
+// left to do, and true when the scan has to go on with what was added.
+func (p *NotionImporter) adoptOrphans(results chan<- *importer.ScanResult) bool {
+	// with rootID, pages outside of the scope wait for no one
+	if p.orphansChecked || p.scope != "" {
+		return false
+	}
+	waiting := p.tree.waitingParents()
+	if len(waiting) == 0 {
+		return false
+	}
+	// the parent may be in the trash rather than hidden
+	if p.archive != nil {
+		for parentID := range waiting {
+			p.archive.push(parentID)
+		}
+		if !p.archive.empty() {
+			return true
+		}
+	}
+	p.orphansChecked = true
+
+	// a page in a toggle or a column of a page that is known, but whose
+	// blocks weren't read as it isn't saved, isn't an orphan
+	hidden := make(map[string]bool)
+	for parentID, parentType := range waiting {
+		if parentType != "block_id" {
+			continue
+		}
+		if pageID, err := p.pageOfBlock(parentID); err == nil && p.tree.known(pageID) {
+			debugf("the pages in block %s are in %s, which isn't saved", parentID, pageID)
+			hidden[parentID] = true
+		}
+	}
+
+	parentIDs := make([]string, 0, len(waiting))
+	for parentID := range waiting {
+		parentIDs = append(parentIDs, parentID)
+	}
+	sort.Strings(parentIDs)
+
+	var records []*importer.ScanResult
+	var names []string
+	p.tree.mu.Lock()
+	for _, parentID := range parentIDs {
+		if hidden[parentID] {
+			continue
+		}
+		for _, node := range p.tree.waiting[parentID] {
+			orphan := manifestOrphan{ID: node.Page.ID, Title: node.Page.title(), Parent: parentID}
+			switch p.orphans {
+			case OrphansTop:
+				p.tree.topLevel[node.Page.ID] = node.Page.Object
+				p.propagateConnectionToRoot(node, &records)
+			case OrphansDirectory:
+				dir := p.orphansNode(&records)
+				node.Parent = dir
+				dir.Children = append(dir.Children, node)
+				p.propagateConnectionToRoot(node, &records)
+			}
+			if node.ConnectedToRoot {
+				orphan.Path = GetPathToRoot(node)
+			}
+			p.stats.orphan(orphan)
+			names = append(names, orphan.Title+" ("+orphan.ID+")")
+		}
+		delete(p.tree.waiting, parentID)
+	}
+	p.tree.mu.Unlock()
+
+	for _, record := range records {
+		results <- record
+	}
+	if len(names) == 0 {
+		return true
+	}
+
+	switch p.orphans {
+	case OrphansSkip:
+		warnf("%d pages have a parent the integration can't see, left out: %s", len(names), strings.Join(names, ", "))
+	case OrphansDirectory:
+		warnf("%d pages have a parent the integration can't see, saved under /%s: %s", len(names), orphansDir, strings.Join(names, ", "))
+	default:
+		warnf("%d pages have a parent the integration can't see, saved at the top: %s", len(names), strings.Join(names, ", "))
+	}
+	return true
+}
+
+// orphansNode returns the directory the orphans are saved in, created on
+// first use, with the tree locked. It isn't a Notion object, so it is kept
+// out of the nodes of the tree.
+func (p *NotionImporter) orphansNode(records *[]*importer.ScanResult) *PageNode {
+	if p.orphanDir == nil {
+		p.orphanDir = &PageNode{Page: Page{ID: orphansDir, Object: "directory"}, ConnectedToRoot: true}
+		*records = append(*records, importer.NewScanRecord("/"+orphansDir, "", objects.NewFileInfo(orphansDir, 0, os.ModeDir|0700, time.Time{}, 0, 0, 0, 0, 0), nil, nil))
+	}
+	return p.orphanDir
+}
+
+// pageOfBlock returns the ID of the page or database a block is in.
+func (p *NotionImporter) pageOfBlock(id string) (string, error) {
+	for {
+		block, err := p.client.fetchFromURL(p.client.url("/blocks/%s", id))
+		if err != nil {
+			return "", err
+		}
+		parent, _ := block["parent"].(map[string]any)
+		parentType, _ := parent["type"].(string)
+		parentID, _ := parent[parentType].(string)
+		if parentType != "block_id" {
+			return parentID, nil
+		}
+		id = parentID
+	}
+}
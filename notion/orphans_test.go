@@ -0,0 +1,57 @@
+package notion
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+func TestScanOrphans(t *testing.T) {
+	m := newMockNotion(t)
+	page := m.AddPage("workspace", "", "Spec")
+	// the parent of this page isn't shared with the integration
+	orphan := m.AddPage("page_id", "00000000-0000-4000-8000-999999999999", "Lost")
+	m.AddParagraph(orphan, "still here")
+	secret := m.AddPage("workspace", "", "Secret")
+	toggle := m.AddBlock(secret, "toggle", map[string]any{"rich_text": richText("more")})
+	nested := m.AddPage("block_id", toggle, "Nested")
+
+	files := scanSnapshot(t, newTestImporter(t, m, map[string]string{"exclude": "title:Secret"}))
+	decodeFile[map[string]any](t, files, "/"+page+"/page.json")
+	decodeFile[map[string]any](t, files, "/"+orphan+"/page.json")
+	if _, ok := files["/"+nested+"/page.json"]; ok {
+		t.Errorf("page in a block of an excluded page saved as an orphan")
+	}
+	found := false
+	for _, entry := range decodeFile[[]map[string]any](t, files, "/content.json") {
+		found = found || entry["id"] == orphan
+	}
+	if !found {
+		t.Errorf("orphan missing from content.json")
+	}
+	got := decodeFile[manifest](t, files, "/manifest.json")
+	if len(got.Orphans) != 1 || got.Orphans[0].ID != orphan || got.Orphans[0].Title != "Lost" || got.Orphans[0].Path != "/"+orphan {
+		t.Errorf("manifest orphans = %+v", got.Orphans)
+	}
+
+	files = scanSnapshot(t, newTestImporter(t, m, map[string]string{"orphans": "directory"}))
+	decodeFile[map[string]any](t, files, "/_orphans/"+orphan+"/page.json")
+	if _, ok := files["/"+orphan+"/page.json"]; ok {
+		t.Errorf("orphan saved at the top with orphans=directory")
+	}
+
+	files = scanSnapshot(t, newTestImporter(t, m, map[string]string{"orphans": "skip"}))
+	if _, ok := files["/"+orphan+"/page.json"]; ok {
+		t.Errorf("orphan saved with orphans=skip")
+	}
+	if got := decodeFile[manifest](t, files, "/manifest.json"); len(got.Orphans) != 1 || got.Orphans[0].Path != "" {
+		t.Errorf("manifest orphans = %+v", got.Orphans)
+	}
+
+	cfg := map[string]string{"token": mockToken, "base_url": m.baseURL(), "orphans": "adopt"}
+	if _, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg); err == nil || !strings.Contains(err.Error(), "invalid orphans") {
+		t.Errorf("expected an invalid orphans error, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package notion
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// exportPlan records what a restore would do when the exporter runs with
+// dryrun=true. All methods are no-ops on a nil plan, so the export walk can
+// call them unconditionally.
+type exportPlan struct {
+	pages       int
+	databases   int
+	dataSources int
+	blocks      int
+	files       int
+	comments    int
+	requests    int
+	skipped     map[string]int // block type -> count
+	transformed map[string]int // description -> count
+}
+
+func newExportPlan() *exportPlan {
+	return &exportPlan{
+		skipped:     make(map[string]int),
+		transformed: make(map[string]int),
+	}
+}
+
+// fakeID returns a placeholder object ID so that the walk can go on as if
+// the object had been created.
+func (p *exportPlan) fakeID() string {
+	return fmt.Sprintf("dryrun-%d", p.requests)
+}
+
+func (p *exportPlan) page() string {
+	p.pages++
+	p.requests++
+	return p.fakeID()
+}
+
+func (p *exportPlan) database() string {
+	p.databases++
+	p.requests++
+	return p.fakeID()
+}
+
+func (p *exportPlan) dataSource() string {
+	p.dataSources++
+	p.requests++
+	return p.fakeID()
+}
+
+func (p *exportPlan) block() string {
+	p.blocks++
+	p.requests++
+	return p.fakeID()
+}
+
+// file accounts for a file upload, which takes two requests: one to create
+// the upload and one to send its content.
+func (p *exportPlan) file() string {
+	p.files++
+	p.requests += 2
+	return p.fakeID()
+}
+
+func (p *exportPlan) comment() {
+	p.comments++
+	p.requests++
+}
+
+func (p *exportPlan) skip(blockType string) {
+	if p == nil {
+		return
+	}
+	p.skipped[blockType]++
+}
+
+func (p *exportPlan) transform(what string) {
+	if p == nil {
+		return
+	}
+	p.transformed[what]++
+}
+
+func (p *exportPlan) print(w io.Writer) {
+	fmt.Fprintf(w, "notion: restore plan (dry run)\n")
+	fmt.Fprintf(w, "  pages:        %d\n", p.pages)
+	fmt.Fprintf(w, "  databases:    %d\n", p.databases)
+	if p.dataSources > 0 {
+		fmt.Fprintf(w, "  data sources: %d\n", p.dataSources)
+	}
+	fmt.Fprintf(w, "  blocks:       %d\n", p.blocks)
+	fmt.Fprintf(w, "  files:        %d\n", p.files)
+	fmt.Fprintf(w, "  comments:     %d\n", p.comments)
+	fmt.Fprintf(w, "  API requests: %d\n", p.requests)
+	printCounts(w, "skipped blocks", p.skipped)
+	printCounts(w, "transformed", p.transformed)
+}
+
+func printCounts(w io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "  %s:\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "    %s: %d\n", k, counts[k])
+	}
+}
@@ -0,0 +1,43 @@
+package notion
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExportPlanPrint(t *testing.T) {
+	p := newExportPlan()
+	p.page()
+	p.database()
+	p.block()
+	p.block()
+	if id := p.file(); id != "dryrun-6" {
+		t.Errorf("file placeholder ID = %q, want dryrun-6", id)
+	}
+	p.comment()
+	p.skip("image")
+	p.skip("image")
+	p.transform("database row restored as a page")
+
+	var nilPlan *exportPlan
+	nilPlan.skip("image")
+	nilPlan.transform("ignored")
+
+	var buf bytes.Buffer
+	p.print(&buf)
+	want := `notion: restore plan (dry run)
+  pages:        1
+  databases:    1
+  blocks:       2
+  files:        1
+  comments:     1
+  API requests: 7
+  skipped blocks:
+    image: 2
+  transformed:
+    database row restored as a page: 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("plan =\n%s\nwant\n%s", got, want)
+	}
+}
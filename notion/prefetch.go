@@ -0,0 +1,137 @@
+package notion
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// prefetcher fetches the blocks of pages ahead of their readers, so that
+// several block trees are fetched in parallel, while plakar reads them one
+// by one. The number of workers is bounded by the workers option, and the
+// number of fetched lists waiting for their reader too, to bound memory.
+// A reader whose list isn't being fetched yet fetches it itself, so that
+// it never waits on a queue held back by lists read later.
+type prefetcher struct {
+	client   *client
+	maxReady int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*prefetch
+	jobs   map[string]*prefetch // by page or block ID
+	ready  int                  // fetched lists not taken yet
+	closed bool
+}
+
+type prefetch struct {
+	id     string
+	state  int // one of prefetchPending, prefetchRunning, prefetchDone or prefetchTaken
+	blocks []json.RawMessage
+	err    error
+}
+
+const (
+	prefetchPending = iota
+	prefetchRunning
+	prefetchDone
+	prefetchTaken // left to the reader before a worker started it
+)
+
+// newPrefetcher starts workers goroutines, it returns nil when workers is
+// 0 and the blocks are only fetched by the readers.
+func newPrefetcher(c *client, workers int) *prefetcher {
+	if workers == 0 {
+		return nil
+	}
+	f := &prefetcher{
+		client:   c,
+		maxReady: 2 * workers,
+		jobs:     make(map[string]*prefetch),
+	}
+	f.cond = sync.NewCond(&f.mu)
+	for i := 0; i < workers; i++ {
+		go f.work()
+	}
+	return f
+}
+
+// push queues the block list of a page or block.
+func (f *prefetcher) push(id string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed || f.jobs[id] != nil {
+		return
+	}
+	job := &prefetch{id: id}
+	f.jobs[id] = job
+	f.queue = append(f.queue, job)
+	f.cond.Signal()
+}
+
+func (f *prefetcher) work() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		for !f.closed && (len(f.queue) == 0 || f.ready >= f.maxReady) {
+			f.cond.Wait()
+		}
+		if f.closed {
+			return
+		}
+		job := f.queue[0]
+		f.queue = f.queue[1:]
+		if job.state == prefetchTaken {
+			continue
+		}
+		job.state = prefetchRunning
+		f.mu.Unlock()
+
+		blocks, err := f.client.fetchList(f.client.url("/blocks/%s/children?page_size=%d", job.id, f.client.pageSize))
+
+		f.mu.Lock()
+		job.blocks, job.err = blocks, err
+		job.state = prefetchDone
+		f.ready++
+		f.cond.Broadcast()
+	}
+}
+
+// take returns the blocks of a page or block fetched by a worker, waiting
+// for a fetch in progress. ok is false when the reader has to fetch them.
+func (f *prefetcher) take(id string) (blocks []json.RawMessage, ok bool, err error) {
+	if f == nil {
+		return nil, false, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job := f.jobs[id]
+	if job == nil {
+		return nil, false, nil
+	}
+	delete(f.jobs, id)
+	if job.state == prefetchPending {
+		job.state = prefetchTaken
+		return nil, false, nil
+	}
+	for job.state == prefetchRunning {
+		f.cond.Wait()
+	}
+	f.ready--
+	f.cond.Broadcast()
+	return job.blocks, true, job.err
+}
+
+// close stops the workers, the lists they haven't started are left to the
+// readers.
+func (f *prefetcher) close() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.cond.Broadcast()
+}
@@ -0,0 +1,98 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+// blockFiles returns the page.json and blocks.json files of a snapshot.
+func blockFiles(files map[string][]byte) map[string][]byte {
+	saved := make(map[string][]byte)
+	for pathname, data := range files {
+		if name := path.Base(pathname); name == "page.json" || name == "blocks.json" {
+			saved[pathname] = data
+		}
+	}
+	return saved
+}
+
+func TestScanPageSizeAndWorkers(t *testing.T) {
+	m := newMockNotion(t)
+	m.pageSize = 100
+	f := newFixture(m)
+	for i := 0; i < 5; i++ {
+		m.AddParagraph(f.page, "more text")
+	}
+
+	m.requests = 0
+	want := blockFiles(scanSnapshot(t, newTestImporter(t, m, map[string]string{"page_size": "1", "workers": "0"})))
+	oneByOne := m.requestCount()
+
+	for _, workers := range []string{"1", "8"} {
+		m.requests = 0
+		got := blockFiles(scanSnapshot(t, newTestImporter(t, m, map[string]string{"workers": workers})))
+		if m.requestCount() >= oneByOne {
+			t.Errorf("workers=%s: %d requests with the default page size, %d with page_size=1", workers, m.requestCount(), oneByOne)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("workers=%s: %d files saved, expected %d", workers, len(got), len(want))
+		}
+		for pathname, data := range want {
+			if !bytes.Equal(got[pathname], data) {
+				t.Errorf("workers=%s: %s differs from the one read without workers", workers, pathname)
+			}
+		}
+	}
+
+	for _, cfg := range []map[string]string{
+		{"page_size": "0"},
+		{"page_size": "101"},
+		{"workers": "-1"},
+		{"rate_limit": "fast"},
+	} {
+		cfg["token"] = mockToken
+		cfg["base_url"] = m.baseURL()
+		if _, err := NewNotionImporter(context.Background(), &importer.Options{}, "notion", cfg); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("%v: expected an invalid option error, got %v", cfg, err)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	for value, want := range map[string]time.Duration{"": time.Second / DefaultRateLimit, "0": 0, "10": 100 * time.Millisecond} {
+		cfg := map[string]string{"token": mockToken}
+		if value != "" {
+			cfg["rate_limit"] = value
+		}
+		c, err := newClientFromConfig(cfg)
+		if err != nil {
+			t.Fatalf("rate_limit=%q: %v", value, err)
+		}
+		if c.limiter.interval != want {
+			t.Errorf("rate_limit=%q: %v between requests, want %v", value, c.limiter.interval, want)
+		}
+	}
+
+	l := &limiter{interval: 20 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		l.wait()
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 requests sent in %v, expected at least 60ms", elapsed)
+	}
+
+	l = &limiter{}
+	l.pause(50 * time.Millisecond)
+	start = time.Now()
+	l.wait()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("request sent %v after a pause of 50ms", elapsed)
+	}
+}
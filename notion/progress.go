@@ -0,0 +1,207 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/kloset/kcontext"
+	"github.com/PlakarKorp/kloset/logging"
+)
+
+const defaultProgressInterval = 10 * time.Second
+
+// Kinds of objects counted by the progress of a backup or a restore.
+const (
+	kindPage       = "page"
+	kindDatabase   = "database"
+	kindDataSource = "data_source"
+	kindBlock      = "block"
+	kindFile       = "file"
+)
+
+// progress reports how far a backup or a restore is, every interval and
+// once it is done. Reports are logged at the info level, and to the logger
+// of a kcontext.KContext when the connector is linked into plakar; a plugin
+// run by the SDK gets a plain context, and only logs them. All methods are
+// no-ops on a nil progress, such as the one of a verification.
+type progress struct {
+	op       string // "backup" or "restore"
+	verb     string // what is done to the objects: "fetched" or "created"
+	interval time.Duration
+	logger   *logging.Logger
+
+	mu          sync.Mutex
+	started     time.Time
+	discovered  map[string]int // kind -> objects found
+	done        map[string]int // kind -> objects fetched or created
+	requests    int
+	rateLimited int
+	waited      time.Duration
+	stop        chan struct{}
+}
+
+// newProgress returns the progress of an operation, reported every
+// progress_interval of config, defaultProgressInterval by default and
+// never with 0.
+func newProgress(ctx context.Context, config map[string]string, op, verb string) (*progress, error) {
+	interval := defaultProgressInterval
+	if value, ok := config["progress_interval"]; ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid progress_interval value %q: %w", value, err)
+		}
+		interval = d
+	}
+	pr := &progress{
+		op:         op,
+		verb:       verb,
+		interval:   interval,
+		discovered: make(map[string]int),
+		done:       make(map[string]int),
+	}
+	if kctx, ok := ctx.(*kcontext.KContext); ok {
+		pr.logger = kctx.GetLogger()
+	}
+	return pr, nil
+}
+
+// start begins the periodic reports.
+func (pr *progress) start() {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	pr.started = time.Now()
+	pr.stop = make(chan struct{})
+	pr.mu.Unlock()
+	if pr.interval <= 0 {
+		return
+	}
+
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(pr.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pr.report(false)
+			case <-stop:
+				return
+			}
+		}
+	}(pr.stop)
+}
+
+// finish stops the periodic reports and reports the totals.
+func (pr *progress) finish() {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	if pr.stop == nil {
+		pr.mu.Unlock()
+		return
+	}
+	close(pr.stop)
+	pr.stop = nil
+	pr.mu.Unlock()
+	pr.report(true)
+}
+
+func (pr *progress) discover(kind string) {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.discovered[kind]++
+}
+
+func (pr *progress) complete(kind string, count int) {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.done[kind] += count
+}
+
+func (pr *progress) request() {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.requests++
+}
+
+// rateLimit counts a rate-limited request, retried after wait.
+func (pr *progress) rateLimit(wait time.Duration) {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.rateLimited++
+	pr.waited += wait
+}
+
+func (pr *progress) report(final bool) {
+	msg := pr.String()
+	if final {
+		pr.mu.Lock()
+		started := pr.started
+		pr.mu.Unlock()
+		msg += fmt.Sprintf(", done in %s", time.Since(started).Round(time.Second))
+	}
+	infof("%s", msg)
+	if pr.logger != nil {
+		pr.logger.Info("%s", msg)
+	}
+}
+
+// String summarizes the progress, with the time left estimated from the
+// pace at which pages, databases and data sources are done.
+func (pr *progress) String() string {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	var parts []string
+	total, done := 0, 0
+	for _, kind := range []string{kindPage, kindDatabase, kindDataSource} {
+		if pr.discovered[kind] == 0 && pr.done[kind] == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d/%d %ss", pr.done[kind], pr.discovered[kind], strings.ReplaceAll(kind, "_", " ")))
+		total += pr.discovered[kind]
+		done += pr.done[kind]
+	}
+	var others []string
+	for kind := range pr.done {
+		if kind == kindBlock || kind == kindFile {
+			others = append(others, kind)
+		}
+	}
+	sort.Strings(others)
+	for _, kind := range others {
+		parts = append(parts, fmt.Sprintf("%d %ss", pr.done[kind], kind))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "nothing yet")
+	}
+
+	msg := fmt.Sprintf("%s: %s %s; %d API requests", pr.op, pr.verb, strings.Join(parts, ", "), pr.requests)
+	if pr.rateLimited > 0 {
+		msg += fmt.Sprintf(", %d rate limited (%s waited)", pr.rateLimited, pr.waited.Round(time.Second))
+	}
+	if done > 0 && done < total {
+		elapsed := time.Since(pr.started)
+		left := time.Duration(float64(elapsed) * float64(total-done) / float64(done))
+		msg += fmt.Sprintf(", about %s left", left.Round(time.Second))
+	}
+	return msg
+}
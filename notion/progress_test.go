@@ -0,0 +1,40 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestProgressReports(t *testing.T) {
+	var buf bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	src := newMockNotion(t)
+	newFixture(src)
+	src.throttle = 5
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+	if !strings.Contains(buf.String(), "backup: fetched 3/3 pages, 1/1 databases, 7 blocks, 2 files;") {
+		t.Errorf("backup progress not reported:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "rate limited") {
+		t.Errorf("rate limit waits not reported:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, nil)
+	restoreSnapshot(t, exp, files)
+	if !strings.Contains(buf.String(), "restore: created 3/3 pages, 1/1 databases") {
+		t.Errorf("restore progress not reported:\n%s", buf.String())
+	}
+
+	if _, err := newProgress(context.Background(), map[string]string{"progress_interval": "often"}, "backup", "fetched"); err == nil {
+		t.Errorf("expected an invalid progress_interval error")
+	}
+}
@@ -0,0 +1,41 @@
+package notion
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter spaces the requests of a client, shared by every goroutine
+// calling the API. A rate-limited response holds back all the requests,
+// not only the one that is retried, so that parallel fetches don't keep
+// hitting the limit.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration // minimum time between two requests, 0 for no limit
+	next     time.Time     // earliest time of the next request
+}
+
+// wait blocks until the next request can be sent.
+func (l *limiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// pause holds back the requests sent within d.
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); l.next.Before(until) {
+		l.next = until
+	}
+}
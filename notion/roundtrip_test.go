@@ -0,0 +1,107 @@
+package notion
+
+import (
+	"testing"
+)
+
+// blockTexts returns the type and plain text of the blocks of a page,
+// descending into blocks with children.
+func blockTexts(m *mockNotion, id string) []string {
+	var texts []string
+	for _, block := range m.Children(id) {
+		blockType, _ := block["type"].(string)
+		text := blockType
+		if content, ok := block[blockType].(map[string]any); ok {
+			if rt, ok := content["rich_text"].([]any); ok {
+				text += ":" + plainText(rt)
+			}
+		}
+		texts = append(texts, text)
+		if blockType != "child_page" && blockType != "child_database" {
+			texts = append(texts, blockTexts(m, block["id"].(string))...)
+		}
+	}
+	return texts
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, map[string]string{"comments": CommentsAll}))
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, map[string]string{"comment_attribution": "true"})
+	restoreSnapshot(t, exp, files)
+
+	restored := childTitles(dst, root)["Spec"]
+	if restored == "" {
+		t.Fatalf("Spec not restored under the root")
+	}
+
+	// Images are not restored yet, everything else must match.
+	var want []string
+	for _, text := range blockTexts(src, f.page) {
+		if text != "image" {
+			want = append(want, text)
+		}
+	}
+	if got := blockTexts(dst, restored); !equalStrings(got, want) {
+		t.Errorf("restored blocks differ:\n got: %v\nwant: %v", got, want)
+	}
+
+	restoredChild := childTitles(dst, restored)["Child"]
+	if got, want := blockTexts(dst, restoredChild), blockTexts(src, f.child); !equalStrings(got, want) {
+		t.Errorf("restored child page differs:\n got: %v\nwant: %v", got, want)
+	}
+
+	restoredDatabase := childTitles(dst, restored)["Tasks"]
+	var rows []string
+	for _, id := range dst.order {
+		obj := dst.Object(id)
+		if parent, _ := obj["parent"].(map[string]any); parent["database_id"] == restoredDatabase {
+			rows = append(rows, titleOf(obj))
+		}
+	}
+	if !equalStrings(rows, []string{"Task 1"}) {
+		t.Errorf("restored rows = %v", rows)
+	}
+
+	icon, _ := dst.Object(restored)["icon"].(map[string]any)
+	if icon["type"] != "file_upload" {
+		t.Fatalf("icon not uploaded: %v", icon)
+	}
+	uploadID := icon["file_upload"].(map[string]any)["id"].(string)
+	if got := string(dst.Upload(uploadID)); got != "icon-bytes" {
+		t.Errorf("uploaded icon = %q", got)
+	}
+
+	pageComments := dst.Comments(restored)
+	if len(pageComments) != 1 {
+		t.Fatalf("restored page has %d comments, want 1", len(pageComments))
+	}
+	text := pageComments[0]["rich_text"].([]any)[0].(map[string]any)["text"].(map[string]any)["content"].(string)
+	if text != "Ada (2025-01-01T00:00:00.000Z): looks good" {
+		t.Errorf("comment attribution = %q", text)
+	}
+
+	var blockComments int
+	for _, block := range dst.Children(restored) {
+		blockComments += len(dst.Comments(block["id"].(string)))
+	}
+	if blockComments != 1 {
+		t.Errorf("restored blocks have %d comments, want 1", blockComments)
+	}
+}
@@ -0,0 +1,58 @@
+package notion
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// tokenSources are the options a token can be given with. token holds it
+// as is, the others tell where to get it so that it can stay in a secret
+// manager rather than in the plakar configuration.
+var tokenSources = []string{"token", "token_file", "token_env", "token_cmd"}
+
+// resolveToken returns the token of a connector configuration from the
+// one of token, token_file, token_env or token_cmd that is set.
+func resolveToken(config map[string]string) (string, error) {
+	source := ""
+	for _, name := range tokenSources {
+		if _, ok := config[name]; !ok {
+			continue
+		}
+		if source != "" {
+			return "", fmt.Errorf("conflicting %s and %s in config, set only one", source, name)
+		}
+		source = name
+	}
+
+	value := config[source]
+	switch source {
+	case "":
+		return "", fmt.Errorf("missing token in config, set one of %s", strings.Join(tokenSources, ", "))
+	case "token":
+		return value, nil
+	case "token_file":
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token_file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case "token_env":
+		token, ok := os.LookupEnv(value)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s of token_env is not set", value)
+		}
+		return strings.TrimSpace(token), nil
+	default:
+		var stderr bytes.Buffer
+		cmd := exec.Command("/bin/sh", "-c", value)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to run token_cmd: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+}
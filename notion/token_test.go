@@ -0,0 +1,43 @@
+package notion
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveToken(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte(mockToken+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NOTION_TEST_TOKEN", mockToken)
+
+	for _, config := range []map[string]string{
+		{"token": mockToken},
+		{"token_file": file},
+		{"token_env": "NOTION_TEST_TOKEN"},
+		{"token_cmd": "echo " + mockToken},
+	} {
+		token, err := resolveToken(config)
+		if err != nil || token != mockToken {
+			t.Errorf("resolveToken(%v) = %q, %v", config, token, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		config map[string]string
+		want   string
+	}{
+		{map[string]string{}, "missing token"},
+		{map[string]string{"token": mockToken, "token_env": "X"}, "conflicting token and token_env"},
+		{map[string]string{"token_file": file + ".missing"}, "failed to read token_file"},
+		{map[string]string{"token_env": "NOTION_TEST_UNSET"}, "is not set"},
+		{map[string]string{"token_cmd": "echo denied >&2; exit 1"}, "denied"},
+	} {
+		if _, err := resolveToken(tt.config); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("resolveToken(%v) = %v, want an error containing %q", tt.config, err, tt.want)
+		}
+	}
+}
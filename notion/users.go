@@ -0,0 +1,223 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// User is the part of a Notion user object needed to map people between
+// workspaces. Bots have no email.
+type User struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Person struct {
+		Email string `json:"email"`
+	} `json:"person"`
+}
+
+// Bot is the integration user a token belongs to.
+type Bot struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Bot  struct {
+		WorkspaceID   string `json:"workspace_id"`
+		WorkspaceName string `json:"workspace_name"`
+	} `json:"bot"`
+}
+
+// workspace returns the name of the workspace of the bot, or its ID when
+// the name is not known.
+func (b *Bot) workspace() string {
+	if b.Bot.WorkspaceName != "" {
+		return b.Bot.WorkspaceName
+	}
+	return b.Bot.WorkspaceID
+}
+
+// fetchBot returns the bot of the token, which fails when the token is not
+// valid.
+func fetchBot(c *client) (*Bot, error) {
+	resp, err := c.do("GET", c.url("/users/me"), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("the token was rejected by Notion, check that it is the secret of an existing integration")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the integration user: %w", c.apiError(c.url("/users/me"), resp))
+	}
+	var bot Bot
+	if err := json.NewDecoder(resp.Body).Decode(&bot); err != nil {
+		return nil, fmt.Errorf("failed to decode bot: %w", err)
+	}
+	return &bot, nil
+}
+
+// fetchUsers lists the users and bots of the workspace. Emails are only
+// returned when the integration has the "read user information including
+// email addresses" capability.
+func fetchUsers(c *client) ([]json.RawMessage, error) {
+	users, err := c.fetchList(c.url("/users?page_size=100"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	return users, nil
+}
+
+// workspaceUsers returns the users of the workspace and their names by ID.
+// They are listed on first use only, for users.json and the people columns
+// of every rows.csv.
+func (p *NotionImporter) workspaceUsers() ([]json.RawMessage, map[string]string, error) {
+	p.usersOnce.Do(func() {
+		p.userList, p.userErr = fetchUsers(p.client)
+		if p.userErr != nil {
+			return
+		}
+		users, err := decodeUsers(p.userList)
+		if err != nil {
+			p.userErr = err
+			return
+		}
+		p.userNames = make(map[string]string, len(users))
+		for id, u := range users {
+			p.userNames[id] = u.Name
+		}
+	})
+	return p.userList, p.userNames, p.userErr
+}
+
+func (p *NotionImporter) newUsersReader() (io.Reader, error) {
+	users, _, err := p.workspaceUsers()
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []json.RawMessage{}
+	}
+	data, err := json.Marshal(users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal users: %w", err)
+	}
+	return bytes.NewReader(data), nil
+}
+
+func decodeUsers(raw []json.RawMessage) (map[string]User, error) {
+	users := make(map[string]User, len(raw))
+	for _, r := range raw {
+		var u User
+		if err := json.Unmarshal(r, &u); err != nil {
+			return nil, fmt.Errorf("failed to decode user: %w", err)
+		}
+		users[u.ID] = u
+	}
+	return users, nil
+}
+
+// loadSnapshotUsers reads the users.json saved at the root of the snapshot.
+// It is only present when the whole snapshot is restored.
+func (n *NotionExporter) loadSnapshotUsers() error {
+	pathname := path.Join(tempDir, "users.json")
+	f, err := os.Open(pathname)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open %s: %w", pathname, err)
+	}
+	defer f.Close()
+
+	var raw []json.RawMessage
+	if err := json.NewDecoder(f).Decode(&raw); err != nil {
+		return fmt.Errorf("failed to decode JSON from %s: %w", pathname, err)
+	}
+	n.users, err = decodeUsers(raw)
+	return err
+}
+
+// buildUserMap matches the users of the snapshot with the users of the
+// target workspace by email.
+func (n *NotionExporter) buildUserMap() error {
+	if n.users == nil {
+		warnf("no users.json in the snapshot, people properties won't be mapped")
+		return nil
+	}
+	if n.plan != nil {
+		n.plan.requests++
+		n.plan.transform("people mapped by email")
+		return nil
+	}
+	if n.usersDenied {
+		// no one can be matched, all people are dropped
+		return nil
+	}
+
+	raw, err := fetchUsers(n.client)
+	if err != nil {
+		return err
+	}
+	targetUsers, err := decodeUsers(raw)
+	if err != nil {
+		return err
+	}
+
+	byEmail := make(map[string]string)
+	for _, u := range targetUsers {
+		if u.Person.Email != "" {
+			byEmail[strings.ToLower(u.Person.Email)] = u.ID
+		}
+	}
+	for _, u := range n.users {
+		if u.Person.Email == "" {
+			continue
+		}
+		if id, ok := byEmail[strings.ToLower(u.Person.Email)]; ok {
+			n.userMap[u.ID] = id
+		}
+	}
+	infof("mapped %d of %d users by email", len(n.userMap), len(n.users))
+	return nil
+}
+
+// mapPeople rewrites the people properties of a page with the matching users
+// of the target workspace. People without a match are dropped, as Notion
+// rejects unknown user IDs.
+func (n *NotionExporter) mapPeople(properties any) {
+	if n.userMap == nil {
+		return
+	}
+	props, _ := properties.(map[string]any)
+	for _, prop := range props {
+		p, ok := prop.(map[string]any)
+		if !ok || p["type"] != "people" {
+			continue
+		}
+		people, _ := p["people"].([]any)
+		mapped := []any{}
+		for _, person := range people {
+			user, _ := person.(map[string]any)
+			oldID, _ := user["id"].(string)
+			if newID, ok := n.userMap[oldID]; ok {
+				mapped = append(mapped, map[string]any{"object": "user", "id": newID})
+			}
+		}
+		p["people"] = mapped
+	}
+}
+
+// userName returns the name of a user of the snapshot, or its ID when
+// the snapshot has no users.json.
+func (n *NotionExporter) userName(id string) string {
+	if u, ok := n.users[id]; ok && u.Name != "" {
+		return u.Name
+	}
+	return id
+}
@@ -0,0 +1,393 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Difference is one structural difference between a snapshot and a live
+// page tree.
+type Difference struct {
+	Path   string // location in the tree, as a path of titles and block types
+	Kind   string // "missing page", "missing block", "extra block", "changed block", "changed property", "missing row" or "dropped file"
+	Detail string
+}
+
+func (d Difference) String() string {
+	if d.Detail == "" {
+		return fmt.Sprintf("%s: %s", d.Path, d.Kind)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Path, d.Kind, d.Detail)
+}
+
+// VerifyReport lists the differences found by Verify.
+type VerifyReport struct {
+	Pages       int
+	Blocks      int
+	Differences []Difference
+}
+
+func (r *VerifyReport) add(pathname, kind, detail string) {
+	r.Differences = append(r.Differences, Difference{Path: pathname, Kind: kind, Detail: detail})
+}
+
+// Print writes the report in a human readable form.
+func (r *VerifyReport) Print(w io.Writer) {
+	for _, d := range r.Differences {
+		fmt.Fprintln(w, d)
+	}
+	fmt.Fprintf(w, "%d pages and %d blocks compared, %d differences\n", r.Pages, r.Blocks, len(r.Differences))
+}
+
+// volatileKeys are fields that legitimately differ between a snapshot and
+// its restored copy and are ignored when comparing.
+var volatileKeys = map[string]bool{
+	"id":               true,
+	"parent":           true,
+	"created_time":     true,
+	"last_edited_time": true,
+	"created_by":       true,
+	"last_edited_by":   true,
+	"request_id":       true,
+	"public_url":       true,
+	"has_children":     true,
+	"children":         true,
+}
+
+// normalize removes IDs and timestamps from a JSON value, and the signed URL
+// of Notion-hosted and uploaded files, which changes on every request. Other
+// URLs, such as those of bookmarks, links and url properties, are compared.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			if volatileKeys[k] {
+				continue
+			}
+			out[k] = normalize(val)
+		}
+		if out["type"] == "file_upload" || out["type"] == "file" {
+			// an upload is read back as a hosted file
+			delete(out, "file_upload")
+			out["type"] = "file"
+			out["file"] = map[string]any{}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = normalize(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func signature(v any) string {
+	data, _ := json.Marshal(normalize(v))
+	return string(data)
+}
+
+// Verify compares the page saved in dir, a directory holding a page.json as
+// produced by the importer, with the live page pageID, for instance the
+// copy made by a restore. config holds the connection options of the
+// connectors, such as token and base_url.
+func Verify(config map[string]string, dir, pageID string) (*VerifyReport, error) {
+	if err := setLogLevel(config); err != nil {
+		return nil, err
+	}
+
+	c, err := newClientFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	v := &verifier{client: c, report: &VerifyReport{}}
+	if err := v.comparePage(dir, normalizeUUID(pageID), ""); err != nil {
+		return nil, err
+	}
+	return v.report, nil
+}
+
+type verifier struct {
+	client *client
+	report *VerifyReport
+}
+
+func (v *verifier) comparePage(dir, pageID, parentPath string) error {
+	snapshot, err := loadJSONFromFile(path.Join(dir, "page.json"))
+	if err != nil {
+		return err
+	}
+	live, err := v.client.fetchFromURL(v.client.url("/pages/%s", pageID))
+	if err != nil {
+		return fmt.Errorf("failed to fetch page %s: %w", pageID, err)
+	}
+	v.report.Pages++
+
+	pagePath := parentPath + "/" + titleOf(snapshot)
+	v.compareProperties(pagePath, snapshot, live)
+	for _, key := range mediaKeys {
+		if snapshot[key] != nil && live[key] == nil {
+			v.report.add(pagePath, "dropped file", key)
+		}
+	}
+
+	children, err := snapshotChildren(snapshot["children"])
+	if err != nil {
+		return err
+	}
+	return v.compareBlocks(dir, children, pageID, pagePath)
+}
+
+// compareProperties compares the properties present on both sides. A row
+// restored as a page only keeps its title, which is compared on its own.
+func (v *verifier) compareProperties(pagePath string, snapshot, live map[string]any) {
+	if titleOf(snapshot) != titleOf(live) {
+		v.report.add(pagePath, "changed property", fmt.Sprintf("title is %q", titleOf(live)))
+	}
+
+	snapshotProps, _ := snapshot["properties"].(map[string]any)
+	liveProps, _ := live["properties"].(map[string]any)
+	names := make([]string, 0, len(snapshotProps))
+	for name := range snapshotProps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop, _ := snapshotProps[name].(map[string]any)
+		if prop["type"] == "title" {
+			continue
+		}
+		liveProp, ok := liveProps[name]
+		if !ok {
+			if _, restored := liveProps["title"]; restored && len(liveProps) == 1 {
+				continue // row restored as a page
+			}
+			v.report.add(pagePath, "changed property", name+" is missing")
+			continue
+		}
+		if signature(prop) != signature(liveProp) {
+			v.report.add(pagePath, "changed property", name)
+		}
+	}
+}
+
+func snapshotChildren(raw any) ([]map[string]any, error) {
+	list, _ := raw.([]any)
+	children := make([]map[string]any, 0, len(list))
+	for _, child := range list {
+		block, ok := child.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unexpected block: %v", child)
+		}
+		children = append(children, block)
+	}
+	return children, nil
+}
+
+func (v *verifier) liveChildren(id string) ([]map[string]any, error) {
+	raw, err := v.client.fetchList(v.client.url("/blocks/%s/children?page_size=%d", id, v.client.pageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch children of %s: %w", id, err)
+	}
+	children := make([]map[string]any, 0, len(raw))
+	for _, r := range raw {
+		var block map[string]any
+		if err := json.Unmarshal(r, &block); err != nil {
+			return nil, fmt.Errorf("failed to decode block: %w", err)
+		}
+		children = append(children, block)
+	}
+	return children, nil
+}
+
+func isFileBlock(blockType any) bool {
+	switch blockType {
+	case "image", "file", "pdf", "video", "audio":
+		return true
+	}
+	return false
+}
+
+// compareBlocks walks the snapshot blocks in order and pairs them with the
+// live ones. Blocks that can't be paired are reported as missing, or as
+// extra when the live side has more.
+func (v *verifier) compareBlocks(dir string, snapshot []map[string]any, liveID, parentPath string) error {
+	live, err := v.liveChildren(liveID)
+	if err != nil {
+		return err
+	}
+
+	j := 0
+	for i, block := range snapshot {
+		v.report.Blocks++
+		blockType, _ := block["type"].(string)
+		blockPath := fmt.Sprintf("%s/%d:%s", parentPath, i, blockType)
+
+		// skip live blocks that were inserted before the next match
+		match := -1
+		for k := j; k < len(live); k++ {
+			if live[k]["type"] == blockType {
+				match = k
+				break
+			}
+		}
+		if match == -1 {
+			if isFileBlock(blockType) {
+				v.report.add(blockPath, "dropped file", "")
+			} else {
+				v.report.add(blockPath, "missing block", "")
+			}
+			continue
+		}
+		for ; j < match; j++ {
+			liveType, _ := live[j]["type"].(string)
+			v.report.add(fmt.Sprintf("%s/%d:%s", parentPath, j, liveType), "extra block", "")
+		}
+		liveBlock := live[j]
+		j++
+
+		liveBlockID, _ := liveBlock["id"].(string)
+		blockID, _ := block["id"].(string)
+		childDir := path.Join(dir, blockID)
+
+		switch blockType {
+		case "child_page":
+			if err := v.comparePage(childDir, liveBlockID, parentPath); err != nil {
+				return err
+			}
+		case "child_database":
+			if err := v.compareDatabase(childDir, liveBlockID, blockPath); err != nil {
+				return err
+			}
+		default:
+			if signature(block[blockType]) != signature(liveBlock[blockType]) {
+				v.report.add(blockPath, "changed block", "")
+			}
+			if hasChildren, _ := block["has_children"].(bool); hasChildren {
+				var children []map[string]any
+				f, err := os.Open(path.Join(childDir, "blocks.json"))
+				if err != nil {
+					v.report.add(blockPath, "missing block", "children not in the snapshot")
+					continue
+				}
+				err = json.NewDecoder(f).Decode(&children)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("failed to decode %s: %w", path.Join(childDir, "blocks.json"), err)
+				}
+				if err := v.compareBlocks(childDir, children, liveBlockID, blockPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for ; j < len(live); j++ {
+		liveType, _ := live[j]["type"].(string)
+		v.report.add(fmt.Sprintf("%s/%d:%s", parentPath, j, liveType), "extra block", "")
+	}
+	return nil
+}
+
+// compareDatabase pairs the rows of a database by title and compares them.
+func (v *verifier) compareDatabase(dir, databaseID, dbPath string) error {
+	rows, err := v.liveRows(databaseID)
+	if err != nil {
+		return err
+	}
+	liveRows := make(map[string]string)
+	for _, row := range rows {
+		id, _ := row["id"].(string)
+		liveRows[titleOf(row)] = id
+	}
+
+	database, err := loadJSONFromFile(path.Join(dir, "database.json"))
+	if err != nil {
+		return err
+	}
+	_, rowDirs, err := snapshotRows(dir, database)
+	if err != nil {
+		return err
+	}
+	for _, rel := range rowDirs {
+		rowDir := path.Join(dir, rel)
+		row, err := loadJSONFromFile(path.Join(rowDir, "page.json"))
+		if err != nil {
+			return err
+		}
+		liveID, ok := liveRows[titleOf(row)]
+		if !ok {
+			v.report.add(dbPath+"/"+titleOf(row), "missing row", "")
+			continue
+		}
+		if err := v.comparePage(rowDir, liveID, dbPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveRows returns the rows of a live database, from each of its data
+// sources when the API version has them.
+func (v *verifier) liveRows(databaseID string) ([]map[string]any, error) {
+	if !v.client.dataSources() {
+		return v.client.queryRows(v.client.url("/databases/%s/query", databaseID))
+	}
+	database, err := v.client.fetchFromURL(v.client.url("/databases/%s", databaseID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch database %s: %w", databaseID, err)
+	}
+	var rows []map[string]any
+	sources, _ := database["data_sources"].([]any)
+	for _, source := range sources {
+		s, _ := source.(map[string]any)
+		id, _ := s["id"].(string)
+		sourceRows, err := v.client.queryRows(v.client.url("/data_sources/%s/query", id))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, sourceRows...)
+	}
+	return rows, nil
+}
+
+// titleOf returns the plain text title of a page or database object.
+func titleOf(object map[string]any) string {
+	if title, ok := object["title"].([]any); ok {
+		return plainText(title)
+	}
+	props, _ := object["properties"].(map[string]any)
+	for _, prop := range props {
+		p, _ := prop.(map[string]any)
+		if p["type"] == "title" {
+			title, _ := p["title"].([]any)
+			return plainText(title)
+		}
+	}
+	return ""
+}
+
+// plainText concatenates the text of a rich text array.
+func plainText(richText []any) string {
+	var sb strings.Builder
+	for _, t := range richText {
+		r, _ := t.(map[string]any)
+		if s, ok := r["plain_text"].(string); ok {
+			sb.WriteString(s)
+		} else if text, ok := r["text"].(map[string]any); ok {
+			s, _ := text["content"].(string)
+			sb.WriteString(s)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,98 @@
+package notion
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSnapshot writes files to dir, as a local plakar restore would.
+func writeSnapshot(t *testing.T, files map[string][]byte, dir string) {
+	t.Helper()
+	for pathname, data := range files {
+		dest := filepath.Join(dir, pathname)
+		if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dest, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyReportsRestoreDifferences(t *testing.T) {
+	src := newMockNotion(t)
+	f := newFixture(src)
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+	dir := t.TempDir()
+	writeSnapshot(t, files, dir)
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, nil)
+	restoreSnapshot(t, exp, files)
+	restored := childTitles(dst, root)["Spec"]
+
+	config := map[string]string{"token": mockToken, "base_url": dst.baseURL(), "rate_limit": "0"}
+	report, err := Verify(config, filepath.Join(dir, f.page), restored)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(report.Differences) != 1 || report.Differences[0].Kind != "dropped file" || !strings.HasSuffix(report.Differences[0].Path, ":image") {
+		t.Fatalf("expected only the image to be reported, got %v", report.Differences)
+	}
+	if report.Pages != 3 {
+		t.Errorf("compared %d pages, want 3", report.Pages)
+	}
+
+	// remove the first paragraph of the restored page
+	dst.DeleteBlock(restored, dst.Children(restored)[0]["id"].(string))
+	report, err = Verify(config, filepath.Join(dir, f.page), restored)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	var missing []string
+	for _, d := range report.Differences {
+		if d.Kind == "missing block" {
+			missing = append(missing, d.Path)
+		}
+	}
+	if len(missing) != 1 || missing[0] != "/Spec/0:paragraph" {
+		t.Fatalf("expected the deleted paragraph to be missing, got %v", report.Differences)
+	}
+}
+
+func TestVerifyReportsChangedURL(t *testing.T) {
+	src := newMockNotion(t)
+	page := src.AddPage("workspace", "", "Links")
+	src.AddBlock(page, "bookmark", map[string]any{"url": "https://example.com/a", "caption": []any{}})
+	files := scanSnapshot(t, newTestImporter(t, src, nil))
+	dir := t.TempDir()
+	writeSnapshot(t, files, dir)
+
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, nil)
+	restoreSnapshot(t, exp, files)
+	restored := childTitles(dst, root)["Links"]
+
+	config := map[string]string{"token": mockToken, "base_url": dst.baseURL(), "rate_limit": "0"}
+	report, err := Verify(config, filepath.Join(dir, page), restored)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(report.Differences) != 0 {
+		t.Fatalf("unexpected differences: %v", report.Differences)
+	}
+
+	bookmark := dst.Children(restored)[0]["id"].(string)
+	dst.SetBlockContent(bookmark, map[string]any{"url": "https://example.com/b", "caption": []any{}})
+	report, err = Verify(config, filepath.Join(dir, page), restored)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(report.Differences) != 1 || report.Differences[0].Kind != "changed block" || report.Differences[0].Path != "/Links/0:bookmark" {
+		t.Fatalf("expected the changed bookmark to be reported, got %v", report.Differences)
+	}
+}
@@ -0,0 +1,366 @@
+package notion
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func hasClass(n *html.Node, class string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "class" {
+			for _, c := range strings.Fields(attr.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// findNode returns the first node below n, n included, matching match.
+func findNode(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findNode(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(sb.String())
+}
+
+// isBlockElement reports elements converted to blocks of their own, that
+// are not part of the text of their parent.
+func isBlockElement(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Ul, atom.Ol, atom.Details, atom.Figure, atom.Div, atom.P, atom.Pre, atom.Table, atom.Blockquote:
+		return true
+	}
+	return false
+}
+
+// parseHTML converts a page of an HTML export into blocks. A database is a
+// page holding a collection table, whose rows link to the pages of the rows.
+func (t *exportTree) parseHTML(obj *exportObject, data []byte) error {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if title := findNode(doc, func(n *html.Node) bool { return hasClass(n, "page-title") }); title != nil {
+		obj.title = textContent(title)
+	}
+
+	if table := findNode(doc, func(n *html.Node) bool { return n.DataAtom == atom.Table && hasClass(n, "collection-content") }); table != nil {
+		obj.kind = "database"
+		t.parseCollection(obj, table)
+		return nil
+	}
+
+	body := findNode(doc, func(n *html.Node) bool { return hasClass(n, "page-body") })
+	if body == nil {
+		body = findNode(doc, func(n *html.Node) bool { return n.DataAtom == atom.Body })
+	}
+	if body != nil {
+		p := &htmlParser{tree: t, obj: obj, b: obj.blocks}
+		obj.content = p.blocks(body)
+	}
+	return nil
+}
+
+// parseCollection reads the columns of a database from the header of its
+// table, and the cells of its rows along with the ID of the row file their
+// title links to.
+func (t *exportTree) parseCollection(obj *exportObject, table *html.Node) {
+	var columns []string
+	var rows [][]string
+	var ids []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.DataAtom == atom.Tr {
+			var cells []string
+			header := false
+			id := ""
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.DataAtom == atom.Th {
+					header = true
+				}
+				if c.DataAtom != atom.Th && c.DataAtom != atom.Td {
+					continue
+				}
+				if cells == nil {
+					if a := findNode(c, func(e *html.Node) bool { return e.DataAtom == atom.A }); a != nil {
+						if m := exportName.FindStringSubmatch(path.Base(t.resolve(obj.file, attr(a, "href")))); m != nil {
+							id = normalizeUUID(m[2])
+						}
+					}
+				}
+				cells = append(cells, textContent(c))
+			}
+			if header && columns == nil {
+				columns = cells
+			} else {
+				rows = append(rows, cells)
+				ids = append(ids, id)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(table)
+
+	obj.setColumns(columns)
+	for i, row := range rows {
+		obj.addRow(row, ids[i])
+	}
+}
+
+type htmlParser struct {
+	tree *exportTree
+	obj  *exportObject
+	b    *blockBuilder
+}
+
+// blocks converts the elements below n into blocks.
+func (p *htmlParser) blocks(n *html.Node) []map[string]any {
+	var blocks []map[string]any
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			blocks = append(blocks, p.element(c)...)
+		}
+	}
+	return blocks
+}
+
+func (p *htmlParser) element(n *html.Node) []map[string]any {
+	switch n.DataAtom {
+	case atom.P:
+		if textContent(n) == "" && findNode(n, func(n *html.Node) bool { return n.DataAtom == atom.Img }) == nil {
+			return nil
+		}
+		return []map[string]any{p.b.text("paragraph", p.inline(n, nil, ""))}
+	case atom.H1:
+		return []map[string]any{p.b.text("heading_1", p.inline(n, nil, ""))}
+	case atom.H2:
+		return []map[string]any{p.b.text("heading_2", p.inline(n, nil, ""))}
+	case atom.H3, atom.H4, atom.H5, atom.H6:
+		return []map[string]any{p.b.text("heading_3", p.inline(n, nil, ""))}
+	case atom.Hr:
+		return []map[string]any{p.b.block("divider", map[string]any{})}
+	case atom.Blockquote:
+		return []map[string]any{p.b.text("quote", p.inline(n, nil, ""))}
+	case atom.Pre:
+		language := "plain text"
+		if code := findNode(n, func(n *html.Node) bool { return n.DataAtom == atom.Code }); code != nil {
+			for _, class := range strings.Fields(attr(code, "class")) {
+				if l, ok := strings.CutPrefix(class, "language-"); ok {
+					language = strings.ToLower(l)
+				}
+			}
+		}
+		return []map[string]any{p.b.block("code", map[string]any{"rich_text": []any{textRun(textContent(n), nil, "")}, "language": language})}
+	case atom.Ul, atom.Ol:
+		var items []map[string]any
+		for li := n.FirstChild; li != nil; li = li.NextSibling {
+			if li.DataAtom != atom.Li {
+				continue
+			}
+			var block map[string]any
+			switch {
+			case hasClass(n, "to-do-list"):
+				checked := findNode(li, func(n *html.Node) bool { return hasClass(n, "checkbox-on") }) != nil
+				block = p.b.block("to_do", map[string]any{"rich_text": p.inline(li, nil, ""), "checked": checked})
+			case n.DataAtom == atom.Ol:
+				block = p.b.text("numbered_list_item", p.inline(li, nil, ""))
+			default:
+				block = p.b.text("bulleted_list_item", p.inline(li, nil, ""))
+			}
+			p.b.addChildren(block, p.nested(li)...)
+			items = append(items, block)
+		}
+		return items
+	case atom.Details:
+		summary := findNode(n, func(n *html.Node) bool { return n.DataAtom == atom.Summary })
+		var rt []any
+		if summary != nil {
+			rt = p.inline(summary, nil, "")
+		}
+		block := p.b.text("toggle", rt)
+		p.b.addChildren(block, p.nested(n)...)
+		return []map[string]any{block}
+	case atom.Figure:
+		return p.figure(n)
+	case atom.Table:
+		return []map[string]any{p.table(n)}
+	case atom.Img:
+		return []map[string]any{p.image(n, nil)}
+	case atom.Div, atom.Section, atom.Article, atom.Main:
+		// layout elements, such as columns and indented content
+		return p.blocks(n)
+	}
+	return nil
+}
+
+// nested converts the block elements of a list item or a toggle.
+func (p *htmlParser) nested(n *html.Node) []map[string]any {
+	var blocks []map[string]any
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && isBlockElement(c) {
+			blocks = append(blocks, p.element(c)...)
+		}
+	}
+	return blocks
+}
+
+func (p *htmlParser) figure(n *html.Node) []map[string]any {
+	switch {
+	case hasClass(n, "link-to-page"):
+		if a := findNode(n, func(n *html.Node) bool { return n.DataAtom == atom.A }); a != nil {
+			if child, ok := p.tree.linkedObject(p.obj.file, attr(a, "href")); ok && child.parent == p.obj {
+				return []map[string]any{p.b.childBlock(child)}
+			}
+			return []map[string]any{p.b.text("paragraph", p.inline(n, nil, ""))}
+		}
+	case hasClass(n, "callout"):
+		return []map[string]any{p.b.text("callout", p.inline(n, nil, ""))}
+	case hasClass(n, "equation"):
+		return []map[string]any{p.b.block("equation", map[string]any{"expression": textContent(n)})}
+	}
+
+	if img := findNode(n, func(n *html.Node) bool { return n.DataAtom == atom.Img }); img != nil {
+		var caption []any
+		if figcaption := findNode(n, func(n *html.Node) bool { return n.DataAtom == atom.Figcaption }); figcaption != nil {
+			caption = p.inline(figcaption, nil, "")
+		}
+		return []map[string]any{p.image(img, caption)}
+	}
+	if textContent(n) == "" {
+		return nil
+	}
+	return []map[string]any{p.b.text("paragraph", p.inline(n, nil, ""))}
+}
+
+func (p *htmlParser) image(img *html.Node, caption []any) map[string]any {
+	if caption == nil {
+		caption = []any{}
+	}
+	src := attr(img, "src")
+	entry := p.tree.resolve(p.obj.file, src)
+	if _, ok := p.tree.z.entries[entry]; !ok {
+		entry = ""
+	}
+	return p.b.image(entry, src, caption)
+}
+
+func (p *htmlParser) table(n *html.Node) map[string]any {
+	var rows [][]any
+	header := false
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.DataAtom == atom.Tr {
+			var cells []any
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.DataAtom == atom.Th || c.DataAtom == atom.Td {
+					if c.DataAtom == atom.Th && len(rows) == 0 {
+						header = true
+					}
+					cells = append(cells, p.inline(c, nil, ""))
+				}
+			}
+			rows = append(rows, cells)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	table := p.b.block("table", map[string]any{"table_width": width, "has_column_header": header, "has_row_header": false})
+	for _, row := range rows {
+		for len(row) < width {
+			row = append(row, []any{})
+		}
+		p.b.addChildren(table, p.b.block("table_row", map[string]any{"cells": row}))
+	}
+	return table
+}
+
+// inline converts the text below n into rich text, skipping the elements
+// that are blocks of their own.
+func (p *htmlParser) inline(n *html.Node, annotations map[string]bool, href string) []any {
+	runs := []any{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			if strings.TrimSpace(c.Data) != "" || len(runs) > 0 {
+				runs = append(runs, textRun(c.Data, annotations, href))
+			}
+		case html.ElementNode:
+			if isBlockElement(c) && n.DataAtom != atom.Figure {
+				continue
+			}
+			a := make(map[string]bool, len(annotations)+1)
+			for k, v := range annotations {
+				a[k] = v
+			}
+			h := href
+			switch c.DataAtom {
+			case atom.Strong, atom.B:
+				a["bold"] = true
+			case atom.Em, atom.I:
+				a["italic"] = true
+			case atom.Code:
+				a["code"] = true
+			case atom.Del, atom.S:
+				a["strikethrough"] = true
+			case atom.U:
+				a["underline"] = true
+			case atom.A:
+				h = attr(c, "href")
+			case atom.Br:
+				runs = append(runs, textRun("\n", annotations, href))
+				continue
+			case atom.Summary, atom.Script, atom.Style:
+				continue
+			}
+			runs = append(runs, p.inline(c, a, h)...)
+		}
+	}
+	return runs
+}
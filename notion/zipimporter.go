@@ -0,0 +1,669 @@
+package notion
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/kloset/objects"
+	"github.com/PlakarKorp/kloset/snapshot/importer"
+)
+
+// ZipScheme is the location prefix of the importer reading a workspace
+// export instead of calling the Notion API.
+const ZipScheme = "notion+zip://"
+
+// ZipImporter reads the ZIP archive produced by Notion's "Markdown & CSV" or
+// "HTML" workspace export, and produces the same tree as NotionImporter so
+// that the snapshot can be restored with NotionExporter.
+type ZipImporter struct {
+	archive string
+	readers []*zip.ReadCloser
+	spooled []string             // nested archives extracted to temporary files
+	entries map[string]*zip.File // archive entries, nested archives included
+}
+
+func newZipImporter(location string) (*ZipImporter, error) {
+	archive := strings.TrimPrefix(location, ZipScheme)
+	if archive == "" {
+		return nil, fmt.Errorf("missing archive path in %q", location)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	return &ZipImporter{archive: archive, entries: make(map[string]*zip.File)}, nil
+}
+
+// open indexes the entries of the archive. Large workspaces are exported as
+// an archive of archives, whose content is merged.
+func (z *ZipImporter) open() error {
+	r, err := zip.OpenReader(z.archive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	z.readers = append(z.readers, r)
+	return z.addEntries(r.File)
+}
+
+func (z *ZipImporter) addEntries(files []*zip.File) error {
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(f.Name), ".zip") {
+			nested, err := z.spool(f)
+			if err != nil {
+				return err
+			}
+			if err := z.addEntries(nested.File); err != nil {
+				return err
+			}
+			continue
+		}
+		z.entries[f.Name] = f
+	}
+	return nil
+}
+
+// spool extracts a nested archive to a temporary file, removed by Close,
+// as the parts of a large export don't fit in memory.
+func (z *ZipImporter) spool(f *zip.File) (*zip.ReadCloser, error) {
+	rd, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rd.Close()
+
+	tmp, err := os.CreateTemp("", "notion-export-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	z.spooled = append(z.spooled, tmp.Name())
+	_, err = io.Copy(tmp, rd)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract nested archive %s: %w", f.Name, err)
+	}
+
+	nested, err := zip.OpenReader(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nested archive %s: %w", f.Name, err)
+	}
+	z.readers = append(z.readers, nested)
+	return nested, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rd, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	return data, nil
+}
+
+// exportName matches the files of pages and databases, named after their
+// title and ID.
+var exportName = regexp.MustCompile(`^(.*) ([0-9a-f]{32})\.(md|csv|html)$`)
+
+// exportObject is a page or database found in the archive.
+type exportObject struct {
+	kind     string // "page" or "database"
+	id       string
+	title    string
+	file     string // Markdown or HTML file of a page, HTML file of a database
+	csv      string // CSV file of a database
+	dir      string // directory holding the children of the object
+	parent   *exportObject
+	children []*exportObject
+
+	blocks  *blockBuilder
+	content []map[string]any
+	columns []string          // database columns, title first
+	lines   []exportLine      // database lines, in order
+	cells   map[string]string // cells of a database row, by column
+}
+
+// exportLine is a line of the CSV file or HTML table of a database.
+type exportLine struct {
+	id    string // ID of the row file an HTML line links to, empty in CSV files
+	title string
+	cells map[string]string // by column
+}
+
+// exportTree is the content of an archive, as pages and databases.
+type exportTree struct {
+	z       *ZipImporter
+	objects map[string]*exportObject // by ID
+	dirs    map[string]*exportObject // by children directory
+	roots   []*exportObject
+}
+
+func (z *ZipImporter) buildTree() (*exportTree, error) {
+	t := &exportTree{z: z, objects: make(map[string]*exportObject), dirs: make(map[string]*exportObject)}
+
+	names := make([]string, 0, len(z.entries))
+	for name := range z.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := exportName.FindStringSubmatch(path.Base(name))
+		if m == nil {
+			continue
+		}
+		id := normalizeUUID(m[2])
+		obj, ok := t.objects[id]
+		if !ok {
+			obj = &exportObject{kind: "page", id: id, title: m[1], dir: path.Join(path.Dir(name), m[1]+" "+m[2])}
+			t.objects[id] = obj
+			t.dirs[obj.dir] = obj
+		}
+		if m[3] == "csv" {
+			obj.kind = "database"
+			obj.csv = name
+		} else {
+			obj.file = name
+		}
+	}
+
+	ids := make([]string, 0, len(t.objects))
+	for id := range t.objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		obj := t.objects[id]
+		if parent, ok := t.dirs[path.Dir(obj.dir)]; ok {
+			obj.parent = parent
+			parent.children = append(parent.children, obj)
+		} else {
+			t.roots = append(t.roots, obj)
+		}
+	}
+
+	// databases first, their columns tell which lines of a row are
+	// properties
+	for _, id := range ids {
+		if obj := t.objects[id]; obj.kind == "database" || strings.HasSuffix(obj.file, ".html") {
+			if err := t.parse(obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, id := range ids {
+		if obj := t.objects[id]; obj.kind == "page" && !strings.HasSuffix(obj.file, ".html") {
+			if err := t.parse(obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+func (t *exportTree) parse(obj *exportObject) error {
+	obj.blocks = newBlockBuilder(obj.id)
+	if obj.csv != "" {
+		data, err := readZipFile(t.z.entries[obj.csv])
+		if err != nil {
+			return err
+		}
+		if err := obj.parseCSV(data); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", obj.csv, err)
+		}
+	}
+	if obj.file == "" {
+		return nil
+	}
+	data, err := readZipFile(t.z.entries[obj.file])
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(obj.file, ".html") {
+		err = t.parseHTML(obj, data)
+	} else {
+		err = t.parseMarkdown(obj, data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", obj.file, err)
+	}
+	return nil
+}
+
+// parseCSV reads the columns and rows of a database. The first column is
+// the title.
+func (obj *exportObject) parseCSV(data []byte) error {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	obj.setColumns(records[0])
+	for _, record := range records[1:] {
+		obj.addRow(record, "")
+	}
+	return nil
+}
+
+func (obj *exportObject) setColumns(columns []string) {
+	obj.columns = columns
+	obj.lines = nil
+}
+
+// addRow records the cells of a line, whose row file has ID id if known.
+func (obj *exportObject) addRow(values []string, id string) {
+	if len(values) == 0 {
+		return
+	}
+	line := exportLine{id: id, title: values[0], cells: make(map[string]string, len(values))}
+	for i, value := range values {
+		if i < len(obj.columns) {
+			line.cells[obj.columns[i]] = value
+		}
+	}
+	obj.lines = append(obj.lines, line)
+}
+
+// schema returns the database properties. Values are exported as text, so
+// every column but the title is restored as rich text.
+func (obj *exportObject) schema() map[string]any {
+	schema := make(map[string]any, len(obj.columns))
+	for i, name := range obj.columns {
+		if i == 0 {
+			schema[name] = map[string]any{"id": "title", "name": name, "type": "title", "title": map[string]any{}}
+		} else {
+			schema[name] = map[string]any{"name": name, "type": "rich_text", "rich_text": map[string]any{}}
+		}
+	}
+	return schema
+}
+
+// rowProperties returns the properties of row, one of the rows of the
+// database.
+func (obj *exportObject) rowProperties(row *exportObject) map[string]any {
+	properties := make(map[string]any, len(obj.columns))
+	for i, name := range obj.columns {
+		if i == 0 {
+			properties[name] = map[string]any{"id": "title", "type": "title", "title": []any{textRun(row.title, nil, "")}}
+			continue
+		}
+		var rt []any
+		if value := row.cells[name]; value != "" {
+			rt = []any{textRun(value, nil, "")}
+		} else {
+			rt = []any{}
+		}
+		properties[name] = map[string]any{"type": "rich_text", "rich_text": rt}
+	}
+	return properties
+}
+
+// matchRows gives the rows of a database the cells of their line. A line
+// of an HTML table links to its row file, whose ID tells the row. A line
+// of a CSV file only has a title: it is matched with the first row file of
+// that title not matched yet. Lines without a row file in the archive
+// become rows of their own.
+func (t *exportTree) matchRows(db *exportObject) {
+	byTitle := make(map[string][]*exportObject)
+	for _, child := range db.children {
+		byTitle[child.title] = append(byTitle[child.title], child)
+	}
+	titled := make(map[string]int) // lines by title
+	for _, line := range db.lines {
+		titled[line.title]++
+	}
+
+	matched := make(map[*exportObject]bool)
+	warned := make(map[string]bool)
+	for _, line := range db.lines {
+		var row *exportObject
+		if line.id != "" {
+			if obj, ok := t.objects[line.id]; ok && obj.parent == db {
+				row = obj
+			}
+		} else {
+			if titled[line.title] > 1 && !warned[line.title] {
+				warnf("database %q has %d rows titled %q, their properties are matched with the row files in order", db.title, titled[line.title], line.title)
+				warned[line.title] = true
+			}
+			for _, obj := range byTitle[line.title] {
+				if !matched[obj] {
+					row = obj
+					break
+				}
+			}
+		}
+		if row == nil {
+			id := line.id
+			if id == "" || t.objects[id] != nil {
+				id = derivedID(db.id, "row", line.title)
+				for n := 2; t.objects[id] != nil; n++ {
+					id = derivedID(db.id, "row", line.title, strconv.Itoa(n))
+				}
+			}
+			row = &exportObject{kind: "page", id: id, title: line.title, parent: db, blocks: newBlockBuilder(id)}
+			db.children = append(db.children, row)
+			t.objects[row.id] = row
+		}
+		matched[row] = true
+		row.cells = line.cells
+	}
+}
+
+// derivedID returns a stable UUID for an object without an ID of its own.
+func derivedID(parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "/")))
+	return normalizeUUID(hex.EncodeToString(sum[:16]))
+}
+
+// blockBuilder creates the blocks of a page, with stable IDs derived from
+// the page ID.
+type blockBuilder struct {
+	pageID   string
+	n        int
+	children map[string][]map[string]any // block ID -> children
+	assets   map[string]string           // image block ID -> archive entry
+}
+
+func newBlockBuilder(pageID string) *blockBuilder {
+	return &blockBuilder{pageID: pageID, children: make(map[string][]map[string]any), assets: make(map[string]string)}
+}
+
+func (b *blockBuilder) block(blockType string, content map[string]any) map[string]any {
+	b.n++
+	return map[string]any{
+		"object":       "block",
+		"id":           derivedID(b.pageID, "block", fmt.Sprint(b.n)),
+		"type":         blockType,
+		blockType:      content,
+		"has_children": false,
+	}
+}
+
+func (b *blockBuilder) text(blockType string, rt []any) map[string]any {
+	return b.block(blockType, map[string]any{"rich_text": rt})
+}
+
+func (b *blockBuilder) addChildren(parent map[string]any, children ...map[string]any) {
+	if len(children) == 0 {
+		return
+	}
+	id := parent["id"].(string)
+	b.children[id] = append(b.children[id], children...)
+	parent["has_children"] = true
+}
+
+// image creates an image block for a file of the archive, or an external
+// image when the file isn't in the archive.
+func (b *blockBuilder) image(entry, target string, caption []any) map[string]any {
+	if entry == "" {
+		return b.block("image", map[string]any{"type": "external", "external": map[string]any{"url": target}, "caption": caption})
+	}
+	block := b.block("image", map[string]any{"type": "file", "file": map[string]any{"url": ""}, "caption": caption})
+	b.assets[block["id"].(string)] = entry
+	return block
+}
+
+// textRun returns a rich text object.
+func textRun(content string, annotations map[string]bool, href string) map[string]any {
+	a := map[string]any{"bold": false, "italic": false, "strikethrough": false, "underline": false, "code": false, "color": "default"}
+	for k, v := range annotations {
+		a[k] = v
+	}
+	run := map[string]any{
+		"type":        "text",
+		"text":        map[string]any{"content": content, "link": nil},
+		"annotations": a,
+		"plain_text":  content,
+		"href":        nil,
+	}
+	if href != "" {
+		run["text"].(map[string]any)["link"] = map[string]any{"url": href}
+		run["href"] = href
+	}
+	return run
+}
+
+// resolve returns the archive entry a relative link of the file at from
+// points to.
+func (t *exportTree) resolve(from, target string) string {
+	if strings.Contains(target, "://") || strings.HasPrefix(target, "#") {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	return path.Join(path.Dir(from), target)
+}
+
+// linkedObject returns the page or database a relative link points to.
+func (t *exportTree) linkedObject(from, target string) (*exportObject, bool) {
+	entry := t.resolve(from, target)
+	if entry == "" {
+		return nil, false
+	}
+	m := exportName.FindStringSubmatch(path.Base(entry))
+	if m == nil {
+		return nil, false
+	}
+	obj, ok := t.objects[normalizeUUID(m[2])]
+	return obj, ok
+}
+
+// childBlock links a page to one of its children.
+func (b *blockBuilder) childBlock(child *exportObject) map[string]any {
+	blockType := "child_" + child.kind
+	return map[string]any{
+		"object":       "block",
+		"id":           child.id,
+		"type":         blockType,
+		blockType:      map[string]any{"title": child.title},
+		"has_children": true,
+	}
+}
+
+// withChildren appends the children of a page that aren't linked from its
+// content. Links are typed and titled once every object is parsed, an HTML
+// page only turns out to be a database when its own file is read.
+func (t *exportTree) withChildren(obj *exportObject) []map[string]any {
+	blocks := obj.content
+	linked := make(map[string]bool)
+	for _, block := range blocks {
+		if blockType := block["type"]; blockType == "child_page" || blockType == "child_database" {
+			id := block["id"].(string)
+			linked[id] = true
+			if child, ok := t.objects[id]; ok {
+				delete(block, blockType.(string))
+				block["type"] = "child_" + child.kind
+				block["child_"+child.kind] = map[string]any{"title": child.title}
+			}
+		}
+	}
+	for _, child := range obj.children {
+		if !linked[child.id] {
+			blocks = append(blocks, obj.blocks.childBlock(child))
+		}
+	}
+	return blocks
+}
+
+func (t *exportTree) parentOf(obj *exportObject) map[string]any {
+	switch {
+	case obj.parent == nil:
+		return map[string]any{"type": "workspace", "workspace": true}
+	case obj.parent.kind == "database":
+		return map[string]any{"type": "database_id", "database_id": obj.parent.id}
+	default:
+		return map[string]any{"type": "page_id", "page_id": obj.parent.id}
+	}
+}
+
+// document returns the page.json or database.json of an object.
+func (t *exportTree) document(obj *exportObject) map[string]any {
+	if obj.title == "" {
+		obj.title = "Untitled"
+	}
+	if obj.kind == "database" {
+		return map[string]any{
+			"object":     "database",
+			"id":         obj.id,
+			"parent":     t.parentOf(obj),
+			"title":      []any{textRun(obj.title, nil, "")},
+			"properties": obj.schema(),
+		}
+	}
+
+	var properties map[string]any
+	if obj.parent != nil && obj.parent.kind == "database" {
+		properties = obj.parent.rowProperties(obj)
+	} else {
+		properties = map[string]any{"title": map[string]any{"id": "title", "type": "title", "title": []any{textRun(obj.title, nil, "")}}}
+	}
+	children := t.withChildren(obj)
+	if children == nil {
+		children = []map[string]any{}
+	}
+	return map[string]any{
+		"object":     "page",
+		"id":         obj.id,
+		"parent":     t.parentOf(obj),
+		"properties": properties,
+		"children":   children,
+	}
+}
+
+func (z *ZipImporter) Scan(ctx context.Context) (<-chan *importer.ScanResult, error) {
+	if err := z.open(); err != nil {
+		return nil, err
+	}
+	tree, err := z.buildTree()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+		results <- importer.NewScanRecord("/", "", objects.NewFileInfo("/", 0, os.ModeDir|0700, time.Time{}, 0, 0, 0, 0, 0), nil, nil)
+
+		content := make([]map[string]any, 0, len(tree.roots))
+		for _, root := range tree.roots {
+			tree.emit(ctx, results, root, "")
+			content = append(content, map[string]any{"parent": map[string]any{"page_id": "/"}, "id": root.id, "object": root.kind})
+		}
+		emitJSON(results, "/content.json", content)
+	}()
+	return results, nil
+}
+
+func emitJSON(results chan<- *importer.ScanResult, pathname string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		results <- importer.NewScanError(pathname, fmt.Errorf("failed to marshal JSON: %w", err))
+		return
+	}
+	name := path.Base(pathname)
+	results <- importer.NewScanRecord(pathname, "", objects.NewFileInfo(name, int64(len(data)), 0700, time.Time{}, 0, 0, 0, 0, 0), nil, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+func emitDir(results chan<- *importer.ScanResult, pathname string) {
+	results <- importer.NewScanRecord(pathname, "", objects.NewFileInfo(path.Base(pathname), 0, os.ModeDir|0700, time.Time{}, 0, 0, 0, 0, 0), nil, nil)
+}
+
+// emit saves an object in the layout of NotionImporter: a directory named
+// after its ID, holding its page.json or database.json, the blocks.json of
+// its blocks with children, its images and its children.
+func (t *exportTree) emit(ctx context.Context, results chan<- *importer.ScanResult, obj *exportObject, parentPath string) {
+	if ctx.Err() != nil {
+		return
+	}
+	if obj.kind == "database" {
+		t.matchRows(obj)
+	}
+
+	dir := parentPath + "/" + obj.id
+	emitDir(results, dir)
+	emitJSON(results, dir+"/"+obj.kind+".json", t.document(obj))
+	t.emitBlocks(results, obj.blocks, obj.content, dir)
+	for _, child := range obj.children {
+		t.emit(ctx, results, child, dir)
+	}
+}
+
+func (t *exportTree) emitBlocks(results chan<- *importer.ScanResult, b *blockBuilder, blocks []map[string]any, dir string) {
+	for _, block := range blocks {
+		id, _ := block["id"].(string)
+		if entry, ok := b.assets[id]; ok {
+			f := t.z.entries[entry]
+			name := id + ".jpg"
+			results <- importer.NewScanRecord(dir+"/"+name, "", objects.NewFileInfo(name, int64(f.UncompressedSize64), 0700, time.Time{}, 0, 0, 0, 0, 0), nil, func() (io.ReadCloser, error) {
+				return f.Open()
+			})
+		}
+		if children, ok := b.children[id]; ok {
+			emitDir(results, dir+"/"+id)
+			emitJSON(results, dir+"/"+id+"/blocks.json", children)
+			t.emitBlocks(results, b, children, dir+"/"+id)
+		}
+	}
+}
+
+func (z *ZipImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("unsupported file: %s", pathname)
+}
+
+func (z *ZipImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on Notion")
+}
+
+func (z *ZipImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on Notion")
+}
+
+func (z *ZipImporter) Close(ctx context.Context) error {
+	for _, r := range z.readers {
+		r.Close()
+	}
+	for _, name := range z.spooled {
+		os.Remove(name)
+	}
+	return nil
+}
+
+func (z *ZipImporter) Root(ctx context.Context) (string, error) {
+	return "/", nil
+}
+
+func (z *ZipImporter) Origin(ctx context.Context) (string, error) {
+	return z.archive, nil
+}
+
+func (z *ZipImporter) Type(ctx context.Context) (string, error) {
+	return "notion", nil
+}
@@ -0,0 +1,203 @@
+package notion
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	exportPage  = "0123456789abcdef0123456789abcdef"
+	exportChild = "11111111111111111111111111111111"
+	exportDB    = "22222222222222222222222222222222"
+	exportRow   = "33333333333333333333333333333333"
+)
+
+// writeZip writes an archive holding files, in order.
+func writeZip(t *testing.T, files [][2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := w.Create(file[0])
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", file[0], err)
+		}
+		f.Write([]byte(file[1]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestZipImporter(t *testing.T, archive []byte) map[string][]byte {
+	t.Helper()
+	pathname := path.Join(t.TempDir(), "export.zip")
+	if err := os.WriteFile(pathname, archive, 0600); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	return scanSnapshot(t, newTestImporter(t, newMockNotion(t), map[string]string{"location": ZipScheme + pathname}))
+}
+
+func TestZipImportMarkdownExport(t *testing.T) {
+	part := writeZip(t, [][2]string{
+		{"Spec " + exportPage + ".md", "# Spec\n\nSome **bold** text\n\n- one\n    - nested\n\n![diagram.png](Spec%20" + exportPage + "/diagram.png)\n\n[Child](Spec%20" + exportPage + "/Child%20" + exportChild + ".md)\n"},
+		{"Spec " + exportPage + "/diagram.png", "image-bytes"},
+		{"Spec " + exportPage + "/Child " + exportChild + ".md", "# Child\n\nchild text\n"},
+		{"Spec " + exportPage + "/Tasks " + exportDB + ".csv", "\xef\xbb\xbfName,Status\nTask 1,Done\nTask 2,Todo\n"},
+		{"Spec " + exportPage + "/Tasks " + exportDB + "/Task 1 " + exportRow + ".md", "# Task 1\n\nStatus: Done\n\nrow text\n"},
+	})
+	files := newTestZipImporter(t, writeZip(t, [][2]string{{"Export-Part-1.zip", string(part)}}))
+
+	page := normalizeUUID(exportPage)
+	db := normalizeUUID(exportDB)
+	row := normalizeUUID(exportRow)
+	for _, pathname := range []string{
+		"/content.json",
+		"/" + page + "/" + normalizeUUID(exportChild) + "/page.json",
+		"/" + page + "/" + db + "/database.json",
+		"/" + page + "/" + db + "/" + row + "/page.json",
+	} {
+		if _, ok := files[pathname]; !ok {
+			t.Errorf("%s missing from the snapshot", pathname)
+		}
+	}
+
+	spec := decodeFile[map[string]any](t, files, "/"+page+"/page.json")
+	if titleOf(spec) != "Spec" {
+		t.Errorf("title = %q", titleOf(spec))
+	}
+	var types []string
+	var list string
+	for _, child := range spec["children"].([]any) {
+		block := child.(map[string]any)
+		types = append(types, block["type"].(string))
+		if block["type"] == "bulleted_list_item" {
+			list = block["id"].(string)
+		}
+		if block["type"] == "image" {
+			if got := string(files["/"+page+"/"+block["id"].(string)+".jpg"]); got != "image-bytes" {
+				t.Errorf("image content = %q", got)
+			}
+		}
+	}
+	if want := []string{"paragraph", "bulleted_list_item", "image", "child_page", "child_database"}; !equalStrings(types, want) {
+		t.Errorf("blocks = %v, want %v", types, want)
+	}
+	nested := decodeFile[[]map[string]any](t, files, "/"+page+"/"+list+"/blocks.json")
+	if len(nested) != 1 || nested[0]["type"] != "bulleted_list_item" {
+		t.Errorf("unexpected nested list: %v", nested)
+	}
+
+	task := decodeFile[map[string]any](t, files, "/"+page+"/"+db+"/"+row+"/page.json")
+	status := task["properties"].(map[string]any)["Status"].(map[string]any)
+	if got := plainText(status["rich_text"].([]any)); got != "Done" {
+		t.Errorf("row status = %q", got)
+	}
+	if children := task["children"].([]any); len(children) != 1 {
+		t.Errorf("row has %d blocks, want 1", len(children))
+	}
+
+	var rows int
+	for pathname := range files {
+		if strings.HasPrefix(pathname, "/"+page+"/"+db+"/") && strings.HasSuffix(pathname, "/page.json") {
+			rows++
+		}
+	}
+	if rows != 2 {
+		t.Errorf("database has %d rows, want 2", rows)
+	}
+
+	// the snapshot restores like an API one
+	dst := newMockNotion(t)
+	root := dst.AddPage("workspace", "", "Restore")
+	exp, _ := newTestExporter(t, dst, root, nil)
+	restoreSnapshot(t, exp, files)
+	restored := childTitles(dst, root)["Spec"]
+	if restored == "" {
+		t.Fatalf("Spec not restored under the root")
+	}
+	if got := blockTexts(dst, restored); !equalStrings(got[:2], []string{"paragraph:Some bold text", "bulleted_list_item:one"}) {
+		t.Errorf("restored blocks = %v", got)
+	}
+}
+
+func TestZipImportHTMLExport(t *testing.T) {
+	files := newTestZipImporter(t, writeZip(t, [][2]string{
+		{"Spec " + exportPage + ".html", `<html><body><article><header><h1 class="page-title">Spec</h1></header><div class="page-body">
+<p>Some <strong>bold</strong> text</p>
+<ul class="to-do-list"><li><div class="checkbox checkbox-on"></div> <span>done</span></li></ul>
+<pre><code class="language-Go">fmt.Println()</code></pre>
+<details><summary>more</summary><p>hidden</p></details>
+<figure class="link-to-page"><a href="Spec%20` + exportPage + `/Tasks%20` + exportDB + `.html">Tasks</a></figure>
+</div></article></body></html>`},
+		{"Spec " + exportPage + "/Tasks " + exportDB + ".html", `<html><body><header><h1 class="page-title">Tasks</h1></header>
+<table class="collection-content"><thead><tr><th>Name</th><th>Status</th></tr></thead>
+<tbody><tr><td><a href="Tasks%20` + exportDB + `/Task%201%20` + exportRow + `.html">Task 1</a></td><td>Done</td></tr></tbody></table></body></html>`},
+		{"Spec " + exportPage + "/Tasks " + exportDB + "/Task 1 " + exportRow + ".html", `<html><body><header><h1 class="page-title">Task 1</h1></header><div class="page-body"><p>row text</p></div></body></html>`},
+	}))
+
+	page := normalizeUUID(exportPage)
+	db := normalizeUUID(exportDB)
+	spec := decodeFile[map[string]any](t, files, "/"+page+"/page.json")
+	var texts []string
+	for _, child := range spec["children"].([]any) {
+		block := child.(map[string]any)
+		blockType := block["type"].(string)
+		content, _ := block[blockType].(map[string]any)
+		rt, _ := content["rich_text"].([]any)
+		texts = append(texts, blockType+":"+strings.TrimSpace(plainText(rt)))
+	}
+	want := []string{"paragraph:Some bold text", "to_do:done", "code:fmt.Println()", "toggle:more", "child_database:"}
+	if !equalStrings(texts, want) {
+		t.Errorf("blocks = %v, want %v", texts, want)
+	}
+
+	database := decodeFile[map[string]any](t, files, "/"+page+"/"+db+"/database.json")
+	if titleOf(database) != "Tasks" {
+		t.Errorf("database title = %q", titleOf(database))
+	}
+	row := decodeFile[map[string]any](t, files, "/"+page+"/"+db+"/"+normalizeUUID(exportRow)+"/page.json")
+	status := row["properties"].(map[string]any)["Status"].(map[string]any)
+	if got := plainText(status["rich_text"].([]any)); got != "Done" {
+		t.Errorf("row status = %q", got)
+	}
+}
+
+func TestZipImportDuplicateRowTitles(t *testing.T) {
+	const other = "44444444444444444444444444444444"
+	part := writeZip(t, [][2]string{
+		{"Tasks " + exportDB + ".csv", "Name,Status\nTask,Done\nTask,Todo\nTask,Later\n"},
+		{"Tasks " + exportDB + "/Task " + exportRow + ".md", "# Task\n\nStatus: Done\n"},
+		{"Tasks " + exportDB + "/Task " + other + ".md", "# Task\n\nStatus: Todo\n"},
+	})
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	files := newTestZipImporter(t, writeZip(t, [][2]string{{"Export-Part-1.zip", string(part)}}))
+
+	db := normalizeUUID(exportDB)
+	var statuses []string
+	for pathname := range files {
+		if strings.HasPrefix(pathname, "/"+db+"/") && strings.HasSuffix(pathname, "/page.json") {
+			row := decodeFile[map[string]any](t, files, pathname)
+			status := row["properties"].(map[string]any)["Status"].(map[string]any)
+			statuses = append(statuses, plainText(status["rich_text"].([]any)))
+		}
+	}
+	sort.Strings(statuses)
+	if want := []string{"Done", "Later", "Todo"}; !equalStrings(statuses, want) {
+		t.Errorf("row statuses = %v, want %v", statuses, want)
+	}
+	for _, id := range []string{exportRow, other} {
+		decodeFile[map[string]any](t, files, "/"+db+"/"+normalizeUUID(id)+"/page.json")
+	}
+
+	if spooled, _ := os.ReadDir(tmp); len(spooled) != 0 {
+		t.Errorf("nested archives left in the temporary directory: %v", spooled)
+	}
+}
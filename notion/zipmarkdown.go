@@ -0,0 +1,386 @@
+package notion
+
+import (
+	"regexp"
+	"strings"
+)
+
+// markdownLine is a line of a Markdown page, with its nesting level.
+type markdownLine struct {
+	level int
+	text  string
+}
+
+var (
+	orderedItem = regexp.MustCompile(`^\d+[.)] `)
+	imageLine   = regexp.MustCompile(`^!\[(.*)\]\((.*)\)$`)
+	linkLine    = regexp.MustCompile(`^\[(.*)\]\((.*)\)$`)
+	tableRule   = regexp.MustCompile(`^\|[\s:|-]+\|$`)
+)
+
+// splitMarkdown splits a page into lines, nested content being indented by
+// four spaces or a tab in Notion's export, two spaces in ours.
+func splitMarkdown(data string) []markdownLine {
+	raw := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	lines := make([]markdownLine, 0, len(raw))
+	for _, line := range raw {
+		level, width := 0, 0
+		for _, r := range line {
+			if r == '\t' {
+				level, width = level+1, 0
+			} else if r == ' ' {
+				width++
+			} else {
+				break
+			}
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		if width >= 4 {
+			level += width / 4
+		} else if width >= 2 {
+			level += width / 2
+		}
+		lines = append(lines, markdownLine{level: level, text: strings.TrimRight(trimmed, " ")})
+	}
+	return lines
+}
+
+// parseMarkdown converts a page of a "Markdown & CSV" export, or of the
+// markdown restore format, into blocks.
+func (t *exportTree) parseMarkdown(obj *exportObject, data []byte) error {
+	lines := splitMarkdown(string(data))
+
+	// front matter of the markdown restore format
+	if len(lines) > 0 && lines[0].text == "---" {
+		for i := 1; i < len(lines); i++ {
+			if lines[i].text == "---" {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+
+	for len(lines) > 0 && lines[0].text == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && strings.HasPrefix(lines[0].text, "# ") {
+		obj.title = strings.TrimPrefix(lines[0].text, "# ")
+		lines = lines[1:]
+	}
+
+	// a row starts with its properties, already read from the CSV
+	if obj.parent != nil && obj.parent.kind == "database" {
+		columns := make(map[string]bool)
+		for _, name := range obj.parent.columns {
+			columns[name] = true
+		}
+		for len(lines) > 0 {
+			name, _, found := strings.Cut(lines[0].text, ": ")
+			if lines[0].text != "" && (!found || !columns[name]) {
+				break
+			}
+			lines = lines[1:]
+		}
+	}
+
+	p := &markdownParser{tree: t, obj: obj, b: obj.blocks}
+	obj.content = p.parse(lines)
+	return nil
+}
+
+type markdownParser struct {
+	tree *exportTree
+	obj  *exportObject
+	b    *blockBuilder
+}
+
+// parse converts lines into blocks. Indented lines are children of the
+// last block of the level above.
+func (p *markdownParser) parse(lines []markdownLine) []map[string]any {
+	var top []map[string]any
+	var stack []map[string]any // last block at each level
+
+	add := func(level int, block map[string]any) {
+		if level > len(stack) {
+			level = len(stack)
+		}
+		if level == 0 {
+			top = append(top, block)
+		} else {
+			p.b.addChildren(stack[level-1], block)
+		}
+		stack = append(stack[:level], block)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		text := line.text
+		switch {
+		case text == "":
+			continue
+
+		case strings.HasPrefix(text, "```"):
+			language := strings.TrimPrefix(text, "```")
+			var code []string
+			for i++; i < len(lines) && lines[i].text != "```"; i++ {
+				code = append(code, lines[i].text)
+			}
+			if language == "" {
+				language = "plain text"
+			}
+			add(line.level, p.b.block("code", map[string]any{"rich_text": []any{textRun(strings.Join(code, "\n"), nil, "")}, "language": language}))
+
+		case text == "$$":
+			var expression []string
+			for i++; i < len(lines) && lines[i].text != "$$"; i++ {
+				expression = append(expression, lines[i].text)
+			}
+			add(line.level, p.b.block("equation", map[string]any{"expression": strings.Join(expression, "\n")}))
+
+		case text == "<details>":
+			summary := ""
+			var inner []markdownLine
+			depth := 1
+			for i++; i < len(lines); i++ {
+				l := lines[i]
+				if l.text == "<details>" {
+					depth++
+				} else if l.text == "</details>" {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+				if summary == "" && strings.HasPrefix(l.text, "<summary>") {
+					summary = strings.TrimSuffix(strings.TrimPrefix(l.text, "<summary>"), "</summary>")
+					continue
+				}
+				inner = append(inner, markdownLine{level: l.level - line.level, text: l.text})
+			}
+			block := p.b.text("toggle", parseInline(summary))
+			p.b.addChildren(block, p.parse(inner)...)
+			add(line.level, block)
+
+		case text == "<aside>":
+			var inner []string
+			for i++; i < len(lines) && lines[i].text != "</aside>"; i++ {
+				if lines[i].text != "" {
+					inner = append(inner, lines[i].text)
+				}
+			}
+			add(line.level, p.b.text("callout", parseInline(strings.Join(inner, "\n"))))
+
+		case strings.HasPrefix(text, "|"):
+			var rows [][]string
+			for ; i < len(lines) && strings.HasPrefix(lines[i].text, "|"); i++ {
+				if !tableRule.MatchString(lines[i].text) {
+					rows = append(rows, splitTableRow(lines[i].text))
+				}
+			}
+			i--
+			add(line.level, p.table(rows))
+
+		case text == "---" || text == "***":
+			add(line.level, p.b.block("divider", map[string]any{}))
+
+		case strings.HasPrefix(text, "### "):
+			add(line.level, p.b.text("heading_3", parseInline(text[4:])))
+		case strings.HasPrefix(text, "## "):
+			add(line.level, p.b.text("heading_2", parseInline(text[3:])))
+		case strings.HasPrefix(text, "# "):
+			add(line.level, p.b.text("heading_1", parseInline(text[2:])))
+
+		case strings.HasPrefix(text, "- [ ] "), strings.HasPrefix(text, "- [x] "):
+			block := p.b.block("to_do", map[string]any{"rich_text": parseInline(text[6:]), "checked": text[3] == 'x'})
+			add(line.level, block)
+		case strings.HasPrefix(text, "- "), strings.HasPrefix(text, "* "):
+			add(line.level, p.b.text("bulleted_list_item", parseInline(text[2:])))
+		case orderedItem.MatchString(text):
+			add(line.level, p.b.text("numbered_list_item", parseInline(orderedItem.ReplaceAllString(text, ""))))
+
+		case strings.HasPrefix(text, "> "):
+			quote := []string{text[2:]}
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1].text, "> ") {
+				i++
+				quote = append(quote, lines[i].text[2:])
+			}
+			add(line.level, p.b.text("quote", parseInline(strings.Join(quote, "\n"))))
+
+		case imageLine.MatchString(text):
+			m := imageLine.FindStringSubmatch(text)
+			entry := p.tree.resolve(p.obj.file, m[2])
+			if _, ok := p.tree.z.entries[entry]; !ok {
+				entry = ""
+			}
+			var caption []any
+			if m[1] != "" && m[1] != "image" {
+				caption = []any{textRun(m[1], nil, "")}
+			} else {
+				caption = []any{}
+			}
+			add(line.level, p.b.image(entry, m[2], caption))
+
+		case linkLine.MatchString(text) && p.childLink(text) != nil:
+			add(line.level, p.childLink(text))
+
+		default:
+			// consecutive lines form a paragraph
+			paragraph := []string{text}
+			for i+1 < len(lines) && lines[i+1].level == line.level && isParagraphLine(lines[i+1].text) {
+				i++
+				paragraph = append(paragraph, lines[i].text)
+			}
+			add(line.level, p.b.text("paragraph", parseInline(strings.Join(paragraph, "\n"))))
+		}
+	}
+	return top
+}
+
+// childLink returns the block of a line linking to a child page or database.
+func (p *markdownParser) childLink(text string) map[string]any {
+	m := linkLine.FindStringSubmatch(text)
+	child, ok := p.tree.linkedObject(p.obj.file, m[2])
+	if !ok || child.parent != p.obj {
+		return nil
+	}
+	return p.b.childBlock(child)
+}
+
+func isParagraphLine(text string) bool {
+	if text == "" || text == "---" || text == "$$" || text == "<details>" || text == "<aside>" {
+		return false
+	}
+	for _, prefix := range []string{"#", "- ", "* ", "> ", "|", "```", "!["} {
+		if strings.HasPrefix(text, prefix) {
+			return false
+		}
+	}
+	return !orderedItem.MatchString(text)
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func (p *markdownParser) table(rows [][]string) map[string]any {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	table := p.b.block("table", map[string]any{"table_width": width, "has_column_header": true, "has_row_header": false})
+	for _, row := range rows {
+		cells := make([]any, width)
+		for i := range cells {
+			cells[i] = []any{}
+			if i < len(row) && row[i] != "" {
+				cells[i] = parseInline(row[i])
+			}
+		}
+		p.b.addChildren(table, p.b.block("table_row", map[string]any{"cells": cells}))
+	}
+	return table
+}
+
+// inlineMarkers are the Markdown annotations, longest first.
+var inlineMarkers = []struct {
+	marker, annotation string
+}{
+	{"**", "bold"},
+	{"~~", "strikethrough"},
+	{"`", "code"},
+	{"*", "italic"},
+}
+
+// parseInline converts Markdown text with emphasis, code and links into a
+// rich text array.
+func parseInline(s string) []any {
+	runs := []any{}
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			runs = append(runs, textRun(plain.String(), nil, ""))
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		if s[i] == '\\' && i+1 < len(s) {
+			plain.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+
+		if s[i] == '[' {
+			if end := strings.Index(s[i:], "]("); end > 0 {
+				if close := strings.IndexByte(s[i+end:], ')'); close > 0 {
+					flush()
+					href := s[i+end+2 : i+end+close]
+					for _, run := range parseInline(s[i+1 : i+end]) {
+						r := run.(map[string]any)
+						runs = append(runs, textRun(r["plain_text"].(string), annotationsOf(r), href))
+					}
+					i += end + close + 1
+					continue
+				}
+			}
+		}
+
+		matched := false
+		for _, m := range inlineMarkers {
+			if !strings.HasPrefix(s[i:], m.marker) {
+				continue
+			}
+			end := strings.Index(s[i+len(m.marker):], m.marker)
+			if end <= 0 {
+				continue
+			}
+			flush()
+			inner := s[i+len(m.marker) : i+len(m.marker)+end]
+			if m.annotation == "code" {
+				runs = append(runs, textRun(inner, map[string]bool{"code": true}, ""))
+			} else {
+				for _, run := range parseInline(inner) {
+					r := run.(map[string]any)
+					a := annotationsOf(r)
+					a[m.annotation] = true
+					href, _ := r["href"].(string)
+					runs = append(runs, textRun(r["plain_text"].(string), a, href))
+				}
+			}
+			i += len(m.marker)*2 + end
+			matched = true
+			break
+		}
+		if !matched {
+			plain.WriteByte(s[i])
+			i++
+		}
+	}
+	flush()
+	return runs
+}
+
+func annotationsOf(run map[string]any) map[string]bool {
+	annotations := make(map[string]bool)
+	a, _ := run["annotations"].(map[string]any)
+	for k, v := range a {
+		if on, ok := v.(bool); ok && on {
+			annotations[k] = true
+		}
+	}
+	return annotations
+}